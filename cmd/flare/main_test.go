@@ -47,7 +47,7 @@ FLARE_CONNINFO_SUBSCRIBER_PORT=5431
 func mustGenerateTestYAML() []byte {
 	publisher := flare.ConnConfig{
 		SuperUser:         "postgres",
-		SuperUserPassword: "password1",
+		SuperUserPassword: flare.Secret{Value: "password1"},
 		Host:              "127.0.0.1",
 		Port:              "5430",
 		SystemIdentifier:  "",
@@ -55,7 +55,7 @@ func mustGenerateTestYAML() []byte {
 
 	subscriber := flare.ConnConfig{
 		SuperUser:         "postgres",
-		SuperUserPassword: "password2",
+		SuperUserPassword: flare.Secret{Value: "password2"},
 		Host:              "127.0.0.1",
 		Port:              "5431",
 		SystemIdentifier:  "",
@@ -63,7 +63,7 @@ func mustGenerateTestYAML() []byte {
 
 	ctx := context.TODO()
 
-	pconn, err := flare.Connect(ctx, publisher.SuperUserInfo(), "postgres")
+	pconn, err := flare.ConnectWithoutVerify(ctx, publisher.SuperUserInfo(), "postgres")
 	if err != nil {
 		panic(err)
 	}
@@ -75,7 +75,7 @@ func mustGenerateTestYAML() []byte {
 		panic(err)
 	}
 
-	sconn, err := flare.Connect(ctx, subscriber.SuperUserInfo(), "postgres")
+	sconn, err := flare.ConnectWithoutVerify(ctx, subscriber.SuperUserInfo(), "postgres")
 	if err != nil {
 		panic(err)
 	}
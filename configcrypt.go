@@ -0,0 +1,187 @@
+package flare
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+const (
+	configKeyEnv     = "FLARE_CONFIG_KEY"
+	configKeyFileEnv = "FLARE_CONFIG_KEY_FILE"
+
+	// ageBinaryHeader is the first line of the age files that are not armored.
+	ageBinaryHeader = "age-encryption.org/v1"
+)
+
+var ErrNoConfigKey = errors.New("flare: the key for the encrypted config is not found (set FLARE_CONFIG_KEY or FLARE_CONFIG_KEY_FILE)")
+
+// IsEncryptedConfig returns true if the config is an age file (armored or not).
+func IsEncryptedConfig(b []byte) bool {
+	b = bytes.TrimSpace(b)
+
+	return bytes.HasPrefix(b, []byte(armor.Header)) || bytes.HasPrefix(b, []byte(ageBinaryHeader))
+}
+
+// ReadConfigKey returns the key for the encrypted config. The key is read from fn if it's given,
+// the file in FLARE_CONFIG_KEY_FILE or FLARE_CONFIG_KEY in this order.
+func ReadConfigKey(fn string) (string, error) {
+	if fn == "" {
+		fn = os.Getenv(configKeyFileEnv)
+	}
+
+	if fn != "" {
+		b, err := os.ReadFile(fn)
+		if err != nil {
+			return "", fmt.Errorf("reading the config key: %w", err)
+		}
+
+		key := strings.TrimRight(string(b), "\r\n")
+		if key == "" {
+			return "", fmt.Errorf("flare: the config key in '%s' is empty", fn)
+		}
+
+		return key, nil
+	}
+
+	if key := os.Getenv(configKeyEnv); key != "" {
+		return key, nil
+	}
+
+	return "", ErrNoConfigKey
+}
+
+// EncryptConfig encrypts the config with age so that the age tools (e.g. age and sops) can decrypt and rotate it.
+// The key is an age identity file (AGE-SECRET-KEY-1...) or a passphrase. The output is armored so it can be
+// stored along with the plaintext configs.
+func EncryptConfig(plaintext []byte, key string) ([]byte, error) {
+	recipients, err := configRecipients(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+
+	aw := armor.NewWriter(&b)
+
+	w, err := age.Encrypt(aw, recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("encrypting the config: %w", err)
+	}
+
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, fmt.Errorf("encrypting the config: %w", err)
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("encrypting the config: %w", err)
+	}
+
+	if err := aw.Close(); err != nil {
+		return nil, fmt.Errorf("armoring the config: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
+
+// DecryptConfig decrypts the config encrypted with age.
+func DecryptConfig(b []byte, key string) ([]byte, error) {
+	if !IsEncryptedConfig(b) {
+		return nil, errors.New("flare: the config is not encrypted")
+	}
+
+	identities, err := configIdentities(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var src io.Reader = bytes.NewReader(bytes.TrimSpace(b))
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte(armor.Header)) {
+		src = armor.NewReader(src)
+	}
+
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			return nil, errors.New("flare: failed to decrypt the config (wrong key?)")
+		}
+
+		return nil, fmt.Errorf("decrypting the config: %w", err)
+	}
+
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("decrypting the config: %w", err)
+	}
+
+	return plaintext, nil
+}
+
+// isAgeIdentities returns true if the key is an age identity file rather than a passphrase.
+func isAgeIdentities(key string) bool {
+	scanner := bufio.NewScanner(strings.NewReader(key))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		return strings.HasPrefix(line, "AGE-SECRET-KEY-1")
+	}
+
+	return false
+}
+
+func configRecipients(key string) ([]age.Recipient, error) {
+	if !isAgeIdentities(key) {
+		r, err := age.NewScryptRecipient(key)
+		if err != nil {
+			return nil, fmt.Errorf("using the passphrase: %w", err)
+		}
+
+		return []age.Recipient{r}, nil
+	}
+
+	identities, err := age.ParseIdentities(strings.NewReader(key))
+	if err != nil {
+		return nil, fmt.Errorf("parsing the age identities: %w", err)
+	}
+
+	var recipients []age.Recipient
+	for _, id := range identities {
+		x, ok := id.(*age.X25519Identity)
+		if !ok {
+			return nil, fmt.Errorf("flare: unsupported age identity %T", id)
+		}
+
+		recipients = append(recipients, x.Recipient())
+	}
+
+	return recipients, nil
+}
+
+func configIdentities(key string) ([]age.Identity, error) {
+	if !isAgeIdentities(key) {
+		id, err := age.NewScryptIdentity(key)
+		if err != nil {
+			return nil, fmt.Errorf("using the passphrase: %w", err)
+		}
+
+		return []age.Identity{id}, nil
+	}
+
+	identities, err := age.ParseIdentities(strings.NewReader(key))
+	if err != nil {
+		return nil, fmt.Errorf("parsing the age identities: %w", err)
+	}
+
+	return identities, nil
+}
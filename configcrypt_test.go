@@ -0,0 +1,99 @@
+package flare
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptConfig(t *testing.T) {
+	require := require.New(t)
+
+	plaintext, err := os.ReadFile("_testdata/example.yml")
+	require.NoError(err)
+
+	require.False(IsEncryptedConfig(plaintext))
+
+	ciphertext, err := EncryptConfig(plaintext, "s3cret")
+	require.NoError(err)
+	require.True(IsEncryptedConfig(ciphertext))
+	require.NotContains(string(ciphertext), "system_identifier")
+
+	actual, err := DecryptConfig(ciphertext, "s3cret")
+	require.NoError(err)
+	require.Equal(plaintext, actual)
+
+	_, err = DecryptConfig(ciphertext, "wrong")
+	require.EqualError(err, "flare: failed to decrypt the config (wrong key?)")
+
+	_, err = DecryptConfig(plaintext, "s3cret")
+	require.EqualError(err, "flare: the config is not encrypted")
+
+	t.Run("Identity", func(t *testing.T) {
+		id, err := age.GenerateX25519Identity()
+		require.NoError(err)
+
+		key := "# created: 2022-10-01T00:00:00Z\n# public key: " + id.Recipient().String() + "\n" + id.String()
+
+		ciphertext, err := EncryptConfig(plaintext, key)
+		require.NoError(err)
+		require.True(strings.HasPrefix(string(ciphertext), "-----BEGIN AGE ENCRYPTED FILE-----\n"))
+
+		// readable by the age tools with the identity
+		r, err := age.Decrypt(armor.NewReader(bytes.NewReader(ciphertext)), id)
+		require.NoError(err)
+
+		actual, err := io.ReadAll(r)
+		require.NoError(err)
+		require.Equal(plaintext, actual)
+
+		actual, err = DecryptConfig(ciphertext, key)
+		require.NoError(err)
+		require.Equal(plaintext, actual)
+
+		other, err := age.GenerateX25519Identity()
+		require.NoError(err)
+
+		_, err = DecryptConfig(ciphertext, other.String())
+		require.EqualError(err, "flare: failed to decrypt the config (wrong key?)")
+	})
+}
+
+func TestReadConfigKey(t *testing.T) {
+	require := require.New(t)
+
+	t.Setenv("FLARE_CONFIG_KEY", "")
+	t.Setenv("FLARE_CONFIG_KEY_FILE", "")
+
+	_, err := ReadConfigKey("")
+	require.ErrorIs(err, ErrNoConfigKey)
+
+	t.Setenv("FLARE_CONFIG_KEY", "from-env")
+
+	key, err := ReadConfigKey("")
+	require.NoError(err)
+	require.Equal("from-env", key)
+
+	fn := filepath.Join(t.TempDir(), "key")
+	require.NoError(os.WriteFile(fn, []byte("from-file\n"), 0o600))
+
+	t.Setenv("FLARE_CONFIG_KEY_FILE", fn)
+
+	key, err = ReadConfigKey("")
+	require.NoError(err)
+	require.Equal("from-file", key)
+
+	other := filepath.Join(t.TempDir(), "other")
+	require.NoError(os.WriteFile(other, []byte("from-flag"), 0o600))
+
+	key, err = ReadConfigKey(other)
+	require.NoError(err)
+	require.Equal("from-flag", key)
+}
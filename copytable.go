@@ -0,0 +1,162 @@
+package flare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type CopyTableOptions struct {
+	// Truncate truncates the table in the destination before copying.
+	Truncate bool
+
+	// OnProgress is called with the total bytes copied so far.
+	OnProgress func(copied int64)
+}
+
+type CopyTableResult struct {
+	Rows  int64
+	Bytes int64
+}
+
+// CopyTable streams `COPY ... TO STDOUT` in src into `COPY ... FROM STDIN` in dst
+// without buffering the whole table. The truncation and the copy are done in a single transaction in dst.
+// The columns are listed by name since the column order may differ between src and dst.
+func CopyTable(ctx context.Context, src, dst *Conn, tbl QualifiedName, opts CopyTableOptions) (CopyTableResult, error) {
+	var result CopyTableResult
+
+	columns, err := ListCopyColumns(ctx, dst, tbl)
+	if err != nil {
+		return result, err
+	}
+
+	tx, err := dst.Begin(ctx)
+	if err != nil {
+		return result, fmt.Errorf("beginning a new transaction in the destination: %w", err)
+	}
+
+	defer tx.Rollback(ctx)
+
+	if opts.Truncate {
+		if _, err := tx.Exec(ctx, TruncateTableQuery(tbl)); err != nil {
+			return result, fmt.Errorf("truncating '%s' in the destination: %w", tbl, err)
+		}
+	}
+
+	pr, pw := io.Pipe()
+
+	copyToErr := make(chan error, 1)
+	go func() {
+		_, err := src.PgConn().CopyTo(ctx, pw, CopyTableToStdoutQuery(tbl, columns))
+		pw.CloseWithError(err)
+		copyToErr <- err
+	}()
+
+	cr := &countingReader{r: pr, onRead: opts.OnProgress}
+
+	tag, err := dst.PgConn().CopyFrom(ctx, cr, CopyTableFromStdinQuery(tbl, columns))
+
+	// unblock the writer in case CopyFrom returns early
+	pr.CloseWithError(io.ErrClosedPipe)
+
+	// the source fails with io.ErrClosedPipe only when the destination has failed first
+	if srcErr := <-copyToErr; srcErr != nil && !errors.Is(srcErr, io.ErrClosedPipe) {
+		return result, fmt.Errorf("copying '%s' from the source: %w", tbl, srcErr)
+	}
+
+	if err != nil {
+		return result, fmt.Errorf("copying '%s' into the destination: %w", tbl, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return result, fmt.Errorf("commiting '%s' in the destination: %w", tbl, err)
+	}
+
+	result.Rows = tag.RowsAffected()
+	result.Bytes = cr.n
+
+	return result, nil
+}
+
+func TruncateTableQuery(tbl QualifiedName) string {
+	return fmt.Sprintf(`TRUNCATE TABLE %s;`, tbl.Quote())
+}
+
+func CopyTableToStdoutQuery(tbl QualifiedName, columns []string) string {
+	return fmt.Sprintf(`COPY %s%s TO STDOUT;`, tbl.Quote(), quoteColumnList(columns))
+}
+
+func CopyTableFromStdinQuery(tbl QualifiedName, columns []string) string {
+	return fmt.Sprintf(`COPY %s%s FROM STDIN;`, tbl.Quote(), quoteColumnList(columns))
+}
+
+// quoteColumnList returns the column list for COPY. COPY copies all the columns when it is empty.
+func quoteColumnList(columns []string) string {
+	if len(columns) == 0 {
+		return ""
+	}
+
+	var quoted []string
+	for _, c := range columns {
+		quoted = append(quoted, quoteIdentifier(c))
+	}
+
+	return " (" + strings.Join(quoted, ", ") + ")"
+}
+
+// ListCopyColumns returns the columns of the table that COPY FROM can write into in the order of the definition.
+// The generated columns are excluded. information_schema is used since attgenerated doesn't exist before PostgreSQL 12.
+func ListCopyColumns(ctx context.Context, conn *Conn, tbl QualifiedName) ([]string, error) {
+	rows, err := conn.Query(ctx, `
+SELECT c.column_name
+FROM information_schema.columns c
+JOIN pg_catalog.pg_class r ON r.relname = c.table_name
+JOIN pg_catalog.pg_namespace n ON n.oid = r.relnamespace AND n.nspname = c.table_schema
+WHERE r.oid = $1::text::regclass AND c.is_generated = 'NEVER'
+ORDER BY c.ordinal_position
+;
+	`, tbl.Quote())
+	if err != nil {
+		return nil, fmt.Errorf("querying the columns of '%s': %w", tbl, err)
+	}
+
+	var columns []string
+
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, fmt.Errorf("scanning the column of '%s': %w", tbl, err)
+		}
+
+		columns = append(columns, column)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("scanning the columns of '%s': %w", tbl, err)
+	}
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("flare: no columns to copy in '%s'", tbl)
+	}
+
+	return columns, nil
+}
+
+type countingReader struct {
+	r      io.Reader
+	n      int64
+	onRead func(int64)
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+
+	if r.onRead != nil && n > 0 {
+		r.onRead(r.n)
+	}
+
+	return n, err
+}
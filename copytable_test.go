@@ -0,0 +1,105 @@
+package flare
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCopyTableQueries(t *testing.T) {
+	require := require.New(t)
+
+	tbl := MustParseQualifiedName(`"my schema"."Orders"`)
+	columns := []string{"id", "Note", `a"b`}
+
+	require.Equal(`TRUNCATE TABLE "my schema"."Orders";`, TruncateTableQuery(tbl))
+	require.Equal(`COPY "my schema"."Orders" ("id", "Note", "a""b") TO STDOUT;`, CopyTableToStdoutQuery(tbl, columns))
+	require.Equal(`COPY "my schema"."Orders" ("id", "Note", "a""b") FROM STDIN;`, CopyTableFromStdinQuery(tbl, columns))
+
+	// without the schema and the columns
+	tbl = MustParseQualifiedName("orders")
+
+	require.Equal(`TRUNCATE TABLE "orders";`, TruncateTableQuery(tbl))
+	require.Equal(`COPY "orders" TO STDOUT;`, CopyTableToStdoutQuery(tbl, nil))
+	require.Equal(`COPY "orders" FROM STDIN;`, CopyTableFromStdinQuery(tbl, nil))
+}
+
+func TestCopyTable(t *testing.T) {
+	require := require.New(t)
+
+	ctx := context.TODO()
+
+	publisher := ConnConfig{
+		SuperUser:         "postgres",
+		SuperUserPassword: Secret{Value: "password1"},
+		Host:              "localhost",
+		Port:              "5430",
+	}
+
+	subscriber := ConnConfig{
+		SuperUser:         "postgres",
+		SuperUserPassword: Secret{Value: "password2"},
+		Host:              "localhost",
+		Port:              "5431",
+	}
+
+	src, err := ConnectWithoutVerify(ctx, publisher.SuperUserInfo(), "postgres")
+	require.NoError(err)
+
+	defer src.Close(ctx)
+
+	dst, err := ConnectWithoutVerify(ctx, subscriber.SuperUserInfo(), "postgres")
+	require.NoError(err)
+
+	defer dst.Close(ctx)
+
+	tbl := MustParseQualifiedName("public.flare_copy_table")
+
+	for _, q := range []string{
+		`DROP TABLE IF EXISTS public.flare_copy_table;`,
+		`CREATE TABLE public.flare_copy_table (id int PRIMARY KEY, "Note" text);`,
+		`INSERT INTO public.flare_copy_table SELECT i, 'note ' || i FROM generate_series(1, 100) AS i;`,
+	} {
+		_, err := src.Exec(ctx, q)
+		require.NoError(err)
+	}
+
+	// the column order differs and the generated column can't be written by COPY
+	for _, q := range []string{
+		`DROP TABLE IF EXISTS public.flare_copy_table;`,
+		`CREATE TABLE public.flare_copy_table ("Note" text, id int PRIMARY KEY, id2 int GENERATED ALWAYS AS (id * 2) STORED);`,
+		`INSERT INTO public.flare_copy_table (id, "Note") VALUES (1000, 'stale');`,
+	} {
+		_, err := dst.Exec(ctx, q)
+		require.NoError(err)
+	}
+
+	defer src.Exec(ctx, `DROP TABLE IF EXISTS public.flare_copy_table;`)
+	defer dst.Exec(ctx, `DROP TABLE IF EXISTS public.flare_copy_table;`)
+
+	columns, err := ListCopyColumns(ctx, dst, tbl)
+	require.NoError(err)
+	require.Equal([]string{"Note", "id"}, columns)
+
+	var progress int64
+	result, err := CopyTable(ctx, src, dst, tbl, CopyTableOptions{
+		Truncate:   true,
+		OnProgress: func(copied int64) { progress = copied },
+	})
+	require.NoError(err)
+	require.Equal(int64(100), result.Rows)
+	require.Equal(result.Bytes, progress)
+
+	var (
+		count int64
+		note  string
+		id2   int64
+	)
+	require.NoError(dst.QueryRow(ctx, `SELECT count(*) FROM public.flare_copy_table;`).Scan(&count))
+	require.Equal(int64(100), count)
+
+	require.NoError(dst.QueryRow(ctx, `SELECT "Note", id2 FROM public.flare_copy_table WHERE id = 42;`).Scan(&note, &id2))
+	require.Equal("note 42", note)
+	require.Equal(int64(84), id2)
+}
@@ -0,0 +1,238 @@
+package flare
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DatabaseConfig overrides how a database in the publisher is created in the subscriber.
+type DatabaseConfig struct {
+	// TargetDBName is the database name in the subscriber. The name in the publisher is used if empty.
+	TargetDBName string `yaml:"target_dbname"`
+
+	Encoding  string `yaml:"encoding"`
+	LCCollate string `yaml:"lc_collate"`
+	LCCtype   string `yaml:"lc_ctype"`
+
+	// ICULocale switches the locale provider to ICU (PostgreSQL 15 or later).
+	ICULocale string `yaml:"icu_locale"`
+}
+
+// SubscriberDBName returns the name in the subscriber for the database in the publisher.
+func (c Config) SubscriberDBName(dbName string) string {
+	if dc, ok := c.Databases[dbName]; ok && dc.TargetDBName != "" {
+		return dc.TargetDBName
+	}
+
+	return dbName
+}
+
+// RemapRoleSettingDatabases renames the databases of the per-database role settings (ALTER ROLE ... IN DATABASE)
+// to the names in the subscriber.
+func (c Config) RemapRoleSettingDatabases(roles []Role) []Role {
+	if len(c.Databases) == 0 {
+		return roles
+	}
+
+	var ret []Role
+
+	for _, r := range roles {
+		settings := make([]RoleSetting, 0, len(r.Settings))
+		for _, st := range r.Settings {
+			if st.DBName != "" {
+				st.DBName = c.SubscriberDBName(st.DBName)
+			}
+			settings = append(settings, st)
+		}
+
+		if len(r.Settings) == 0 {
+			settings = nil
+		}
+
+		r.Settings = settings
+
+		ret = append(ret, r)
+	}
+
+	return ret
+}
+
+// RewriteCreateDatabase rewrites the output of `pg_dump --create` to create the database with the name and
+// the options in the config. The references to the database (ALTER DATABASE, COMMENT ON DATABASE,
+// GRANT/REVOKE ON DATABASE and \connect) are renamed as well.
+func RewriteCreateDatabase(schema, dbName string, dc DatabaseConfig) (string, error) {
+	target := dbName
+	if dc.TargetDBName != "" {
+		target = dc.TargetDBName
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(schema))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	var b strings.Builder
+
+	for scanner.Scan() {
+		t := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(t, `\connect `):
+			t = psqlConnectCommand(target)
+		case strings.HasPrefix(t, "CREATE DATABASE "):
+			t = rewriteCreateDatabaseLine(t, dbName, target, dc)
+		default:
+			t = renameDatabaseInLine(t, dbName, target)
+		}
+
+		fmt.Fprintf(&b, "%s\n", t)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("scanning the schema: %w", err)
+	}
+
+	return b.String(), nil
+}
+
+var simpleDBNameRe = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+// psqlConnectCommand returns \connect in the same form as pg_dump writes.
+func psqlConnectCommand(dbName string) string {
+	if simpleDBNameRe.MatchString(dbName) {
+		return `\connect ` + dbName
+	}
+
+	connstr := buildConnInfo([][2]string{{"dbname", dbName}})
+
+	return `\connect -reuse-previous=on ` + quoteIdentifier(connstr)
+}
+
+func renameDatabaseInLine(line, dbName, target string) string {
+	if dbName == target {
+		return line
+	}
+
+	tokens := tokenizeSQLLine(line)
+
+	var b strings.Builder
+	last := 0
+
+	for i, t := range tokens {
+		if i == 0 || !tokens[i-1].isKeyword("DATABASE") || t.kind == sqlTokenPunct || t.kind == sqlTokenLiteral {
+			continue
+		}
+
+		if t.name() != dbName {
+			continue
+		}
+
+		b.WriteString(line[last:t.start])
+		b.WriteString(quoteIdentifier(target))
+		last = t.end
+	}
+
+	b.WriteString(line[last:])
+
+	return b.String()
+}
+
+type createDatabaseOption struct {
+	key   string
+	value string
+}
+
+func rewriteCreateDatabaseLine(line, dbName, target string, dc DatabaseConfig) string {
+	tokens := tokenizeSQLLine(line)
+
+	// CREATE DATABASE name [WITH] key [=] value ... ;
+	if len(tokens) < 3 || tokens[2].name() != dbName {
+		return line
+	}
+
+	var opts []createDatabaseOption
+
+	for i := 3; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.isKeyword("WITH") || t.kind == sqlTokenPunct {
+			continue
+		}
+
+		j := i + 1
+		if j < len(tokens) && tokens[j].kind == sqlTokenPunct && tokens[j].text == "=" {
+			j++
+		}
+
+		if j >= len(tokens) {
+			break
+		}
+
+		opts = append(opts, createDatabaseOption{key: strings.ToUpper(t.text), value: tokens[j].text})
+		i = j
+	}
+
+	get := func(key string) (string, bool) {
+		for _, o := range opts {
+			if o.key == key {
+				return o.value, true
+			}
+		}
+		return "", false
+	}
+
+	set := func(key, value string) {
+		for i := range opts {
+			if opts[i].key == key {
+				opts[i].value = value
+				return
+			}
+		}
+		opts = append(opts, createDatabaseOption{key: key, value: value})
+	}
+
+	del := func(key string) {
+		var ret []createDatabaseOption
+		for _, o := range opts {
+			if o.key != key {
+				ret = append(ret, o)
+			}
+		}
+		opts = ret
+	}
+
+	if dc.Encoding != "" {
+		set("ENCODING", quoteLiteral(dc.Encoding))
+	}
+
+	// LOCALE can't be specified with LC_COLLATE nor LC_CTYPE
+	if dc.LCCollate != "" || dc.LCCtype != "" {
+		if locale, ok := get("LOCALE"); ok {
+			del("LOCALE")
+			set("LC_COLLATE", locale)
+			set("LC_CTYPE", locale)
+		}
+
+		if dc.LCCollate != "" {
+			set("LC_COLLATE", quoteLiteral(dc.LCCollate))
+		}
+
+		if dc.LCCtype != "" {
+			set("LC_CTYPE", quoteLiteral(dc.LCCtype))
+		}
+	}
+
+	if dc.ICULocale != "" {
+		set("LOCALE_PROVIDER", "icu")
+		set("ICU_LOCALE", quoteLiteral(dc.ICULocale))
+	}
+
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "CREATE DATABASE %s WITH", quoteIdentifier(target))
+	for _, o := range opts {
+		fmt.Fprintf(&b, " %s = %s", o.key, o.value)
+	}
+	b.WriteString(";")
+
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package flare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewriteCreateDatabase(t *testing.T) {
+	input := `CREATE DATABASE bench WITH TEMPLATE = template0 ENCODING = 'UTF8' LOCALE_PROVIDER = libc LOCALE = 'en_US.UTF-8';
+ALTER DATABASE bench OWNER TO dbowner;
+\connect bench
+COMMENT ON DATABASE bench IS 'bench';
+GRANT CONNECT ON DATABASE bench TO app;
+ALTER DATABASE bench SET search_path TO 'bench';
+CREATE TABLE public.bench (id integer);
+`
+
+	t.Run("Rename", func(t *testing.T) {
+		expected := `CREATE DATABASE "Bench 2" WITH TEMPLATE = template0 ENCODING = 'UTF8' LOCALE_PROVIDER = libc LOCALE = 'en_US.UTF-8';
+ALTER DATABASE "Bench 2" OWNER TO dbowner;
+\connect -reuse-previous=on "dbname='Bench 2'"
+COMMENT ON DATABASE "Bench 2" IS 'bench';
+GRANT CONNECT ON DATABASE "Bench 2" TO app;
+ALTER DATABASE "Bench 2" SET search_path TO 'bench';
+CREATE TABLE public.bench (id integer);
+`
+
+		require := require.New(t)
+
+		actual, err := RewriteCreateDatabase(input, "bench", DatabaseConfig{TargetDBName: "Bench 2"})
+		require.NoError(err)
+		require.Equal(expected, actual)
+	})
+
+	t.Run("Options", func(t *testing.T) {
+		expected := `CREATE DATABASE "bench2" WITH TEMPLATE = template0 ENCODING = 'SQL_ASCII' LOCALE_PROVIDER = icu LC_COLLATE = 'C' LC_CTYPE = 'en_US.UTF-8' ICU_LOCALE = 'und';
+ALTER DATABASE "bench2" OWNER TO dbowner;
+\connect bench2
+`
+
+		require := require.New(t)
+
+		actual, err := RewriteCreateDatabase(input, "bench", DatabaseConfig{
+			TargetDBName: "bench2",
+			Encoding:     "SQL_ASCII",
+			LCCollate:    "C",
+			ICULocale:    "und",
+		})
+		require.NoError(err)
+		require.Equal(expected, actual[:len(expected)])
+	})
+
+	t.Run("SubscriberDBName", func(t *testing.T) {
+		require := require.New(t)
+
+		cfg := Config{Databases: map[string]DatabaseConfig{"bench": {TargetDBName: "bench2"}, "other": {Encoding: "UTF8"}}}
+
+		require.Equal("bench2", cfg.SubscriberDBName("bench"))
+		require.Equal("other", cfg.SubscriberDBName("other"))
+		require.Equal("unknown", cfg.SubscriberDBName("unknown"))
+	})
+}
+
+func TestRemapRoleSettingDatabases(t *testing.T) {
+	require := require.New(t)
+
+	cfg := Config{
+		Databases: map[string]DatabaseConfig{
+			"bench": {TargetDBName: "bench_v2"},
+		},
+	}
+
+	roles := []Role{
+		{
+			Name: "app",
+			Settings: []RoleSetting{
+				{Name: "work_mem", Value: "64MB"},
+				{DBName: "bench", Name: "search_path", Value: "app, public"},
+				{DBName: "other", Name: "statement_timeout", Value: "5min"},
+			},
+		},
+		{Name: "readonly"},
+	}
+
+	remapped := cfg.RemapRoleSettingDatabases(roles)
+
+	require.Equal([]RoleSetting{
+		{Name: "work_mem", Value: "64MB"},
+		{DBName: "bench_v2", Name: "search_path", Value: "app, public"},
+		{DBName: "other", Name: "statement_timeout", Value: "5min"},
+	}, remapped[0].Settings)
+	require.Nil(remapped[1].Settings)
+
+	require.Equal(
+		`ALTER ROLE "app" IN DATABASE "bench_v2" SET search_path TO 'app', 'public';`,
+		AlterRoleSetQuery(remapped[0].Name, remapped[0].Settings[1]),
+	)
+
+	// the roles from the publisher are kept
+	require.Equal("bench", roles[0].Settings[1].DBName)
+}
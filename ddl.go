@@ -0,0 +1,492 @@
+package flare
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The log table is created in both sides because the publication for all tables replicates it.
+const ddlLogTableSchema = `
+CREATE TABLE IF NOT EXISTS public.flare_ddl_log (
+    id              BIGSERIAL PRIMARY KEY
+  , captured_at     TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+  , username        TEXT NOT NULL
+  , search_path     TEXT NOT NULL
+  , command_tag     TEXT NOT NULL
+  , object_identity TEXT
+  , ddl             TEXT NOT NULL
+  , backend_pid     INTEGER
+  , statement_at    TIMESTAMP WITH TIME ZONE
+);
+
+ALTER TABLE public.flare_ddl_log ADD COLUMN IF NOT EXISTS backend_pid INTEGER;
+ALTER TABLE public.flare_ddl_log ADD COLUMN IF NOT EXISTS statement_at TIMESTAMP WITH TIME ZONE;
+`
+
+const ddlReplayTableSchema = `
+CREATE TABLE IF NOT EXISTS public.flare_ddl_replay (
+    id         BIGINT PRIMARY KEY
+  , applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+`
+
+// current_query() returns the whole query string sent by the client
+// so multiple statements sent at once are captured together.
+// The trigger fires for each DDL command in the query string so the query string is recorded once
+// per client message (the backend and statement_timestamp()) and the following commands are appended to it.
+//
+// The function is SECURITY DEFINER so that the roles running DDL don't need the privileges on the log table;
+// granting them would let any role forge the DDL that is replayed as the superuser in the subscriber.
+// search_path is pinned so that no function or operator in a schema writable by others runs as the owner.
+// It's pinned in the body rather than with SET in the definition since the caller's search_path is recorded for the replay,
+// and it's restored before returning.
+const ddlCaptureSchema = `
+CREATE OR REPLACE FUNCTION public.flare_capture_ddl() RETURNS event_trigger
+LANGUAGE plpgsql
+SECURITY DEFINER
+AS $$
+DECLARE
+  caller_search_path pg_catalog.text := pg_catalog.current_setting('search_path');
+  objects pg_catalog.text;
+BEGIN
+  PERFORM pg_catalog.set_config('search_path', 'pg_catalog, pg_temp', true);
+
+  objects := (SELECT string_agg(object_identity, ', ') FROM pg_event_trigger_ddl_commands());
+
+  UPDATE public.flare_ddl_log
+  SET
+      command_tag = command_tag || ', ' || tg_tag
+    , object_identity = concat_ws(', ', object_identity, objects)
+  WHERE backend_pid = pg_backend_pid() AND statement_at = statement_timestamp() AND ddl = current_query();
+
+  IF NOT FOUND THEN
+    INSERT INTO public.flare_ddl_log (username, search_path, command_tag, object_identity, ddl, backend_pid, statement_at)
+    VALUES (
+        session_user
+      , caller_search_path
+      , tg_tag
+      , objects
+      , current_query()
+      , pg_backend_pid()
+      , statement_timestamp()
+    );
+  END IF;
+
+  PERFORM pg_catalog.set_config('search_path', caller_search_path, true);
+END;
+$$;
+
+DROP EVENT TRIGGER IF EXISTS flare_ddl_capture;
+CREATE EVENT TRIGGER flare_ddl_capture ON ddl_command_end EXECUTE PROCEDURE public.flare_capture_ddl();
+`
+
+const ddlUninstallSchema = `
+DROP EVENT TRIGGER IF EXISTS flare_ddl_capture;
+DROP FUNCTION IF EXISTS public.flare_capture_ddl();
+`
+
+type DDLCommand struct {
+	ID             int64
+	CapturedAt     time.Time
+	UserName       string
+	SearchPath     string
+	CommandTag     string
+	ObjectIdentity string
+	DDL            string
+}
+
+// InstallDDLCapture creates the log table and the event trigger to capture DDL in the publisher.
+func InstallDDLCapture(ctx context.Context, conn *Conn) error {
+	if _, err := conn.Exec(ctx, ddlLogTableSchema); err != nil {
+		return fmt.Errorf("creating the DDL log table: %w", err)
+	}
+
+	if _, err := conn.Exec(ctx, ddlCaptureSchema); err != nil {
+		return fmt.Errorf("creating the DDL capture event trigger: %w", err)
+	}
+
+	return nil
+}
+
+func UninstallDDLCapture(ctx context.Context, conn *Conn) error {
+	if _, err := conn.Exec(ctx, ddlUninstallSchema); err != nil {
+		return fmt.Errorf("dropping the DDL capture event trigger: %w", err)
+	}
+
+	return nil
+}
+
+// CreateDDLReplayTables creates the tables to receive the log and to track the replayed DDL in the subscriber.
+func CreateDDLReplayTables(ctx context.Context, conn *Conn) error {
+	if _, err := conn.Exec(ctx, ddlLogTableSchema); err != nil {
+		return fmt.Errorf("creating the DDL log table: %w", err)
+	}
+
+	if _, err := conn.Exec(ctx, ddlReplayTableSchema); err != nil {
+		return fmt.Errorf("creating the DDL replay table: %w", err)
+	}
+
+	return nil
+}
+
+func HasDDLCapture(ctx context.Context, conn *Conn) (bool, error) {
+	var exists bool
+
+	if err := conn.QueryRow(
+		ctx,
+		`SELECT to_regclass('public.flare_ddl_log') IS NOT NULL;`,
+	).Scan(&exists); err != nil {
+		return false, fmt.Errorf("querying the DDL log table: %w", err)
+	}
+
+	return exists, nil
+}
+
+func ListDDLCommands(ctx context.Context, conn *Conn, afterID int64) ([]DDLCommand, error) {
+	rows, err := conn.Query(ctx, `
+SELECT id, captured_at, username, search_path, command_tag, COALESCE(object_identity, ''), ddl
+FROM public.flare_ddl_log
+WHERE id > $1
+ORDER BY id
+;
+	`, afterID)
+	if err != nil {
+		return nil, fmt.Errorf("querying the DDL log: %w", err)
+	}
+
+	var cmds []DDLCommand
+
+	for rows.Next() {
+		var c DDLCommand
+		if err := rows.Scan(
+			&c.ID,
+			&c.CapturedAt,
+			&c.UserName,
+			&c.SearchPath,
+			&c.CommandTag,
+			&c.ObjectIdentity,
+			&c.DDL,
+		); err != nil {
+			return nil, fmt.Errorf("scanning the DDL command: %w", err)
+		}
+
+		cmds = append(cmds, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("scanning the DDL commands: %w", err)
+	}
+
+	return cmds, nil
+}
+
+func GetLastReplayedDDLID(ctx context.Context, conn *Conn) (int64, error) {
+	var id int64
+
+	if err := conn.QueryRow(
+		ctx,
+		`SELECT COALESCE(max(id), 0) FROM public.flare_ddl_replay;`,
+	).Scan(&id); err != nil {
+		return 0, fmt.Errorf("querying the last replayed DDL: %w", err)
+	}
+
+	return id, nil
+}
+
+// ListPendingDDLCommands returns the DDL captured in the publisher that hasn't been replayed in the subscriber yet.
+func ListPendingDDLCommands(ctx context.Context, pconn, sconn *Conn) ([]DDLCommand, error) {
+	lastID, err := GetLastReplayedDDLID(ctx, sconn)
+	if err != nil {
+		return nil, err
+	}
+
+	return ListDDLCommands(ctx, pconn, lastID)
+}
+
+// ReplayDDL executes the DDL as the role who ran it in the publisher (mapped by m) and records it.
+// The statements that logical replication already applies (e.g. DML) and the transaction control are skipped.
+// They are executed in a single transaction unless a statement can't run in a transaction block (e.g. CREATE INDEX CONCURRENTLY).
+// The connection must be made by the super user to switch the role.
+func ReplayDDL(ctx context.Context, conn *Conn, c DDLCommand, m RoleMap) error {
+	stmts, inTx, err := replayStatements(c.DDL, m)
+	if err != nil {
+		return fmt.Errorf("parsing the DDL #%d: %w", c.ID, err)
+	}
+
+	role := m.Map(c.UserName)
+
+	if !inTx {
+		return replayDDLWithoutTx(ctx, conn, c, role, stmts)
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("beginning a new transaction: %w", err)
+	}
+
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`SET LOCAL ROLE %s;`, quoteIdentifier(role))); err != nil {
+		return fmt.Errorf("switching the role to '%s': %w", role, err)
+	}
+
+	if _, err := tx.Exec(ctx, `SELECT set_config('search_path', $1, true);`, c.SearchPath); err != nil {
+		return fmt.Errorf("setting the search_path: %w", err)
+	}
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("executing the DDL #%d: %w", c.ID, err)
+		}
+	}
+
+	if _, err := tx.Exec(ctx, `RESET ROLE;`); err != nil {
+		return fmt.Errorf("resetting the role: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, `INSERT INTO public.flare_ddl_replay (id) VALUES ($1);`, c.ID); err != nil {
+		return fmt.Errorf("recording the DDL #%d: %w", c.ID, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("commiting the DDL #%d: %w", c.ID, err)
+	}
+
+	return nil
+}
+
+// replayDDLWithoutTx executes the statements one by one in the session.
+// The DDL is not recorded when a statement fails so the statements that have been executed must be fixed by hand.
+func replayDDLWithoutTx(ctx context.Context, conn *Conn, c DDLCommand, role string, stmts []string) error {
+	if _, err := conn.Exec(ctx, fmt.Sprintf(`SET ROLE %s;`, quoteIdentifier(role))); err != nil {
+		return fmt.Errorf("switching the role to '%s': %w", role, err)
+	}
+
+	defer conn.Exec(ctx, `RESET ROLE; RESET search_path;`)
+
+	if _, err := conn.Exec(ctx, `SELECT set_config('search_path', $1, false);`, c.SearchPath); err != nil {
+		return fmt.Errorf("setting the search_path: %w", err)
+	}
+
+	for i, stmt := range stmts {
+		if _, err := conn.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("executing the statement %d/%d of the DDL #%d outside a transaction (the previous statements have been applied): %w", i+1, len(stmts), c.ID, err)
+		}
+	}
+
+	if _, err := conn.Exec(ctx, `RESET ROLE;`); err != nil {
+		return fmt.Errorf("resetting the role: %w", err)
+	}
+
+	if _, err := conn.Exec(ctx, `INSERT INTO public.flare_ddl_replay (id) VALUES ($1);`, c.ID); err != nil {
+		return fmt.Errorf("recording the DDL #%d: %w", c.ID, err)
+	}
+
+	return nil
+}
+
+// replayStatements splits the captured query string into the statements to replay with the role names remapped.
+// inTx is false when a statement can't run in a transaction block.
+func replayStatements(query string, m RoleMap) (stmts []string, inTx bool, err error) {
+	inTx = true
+
+	for _, stmt := range splitSQLStatements(query) {
+		if skipReplayStatement(stmt) {
+			continue
+		}
+
+		if stmt.hasKeyword("CONCURRENTLY") {
+			inTx = false
+		}
+
+		text, err := RemapRoleNames(stmt.text, m)
+		if err != nil {
+			return nil, false, err
+		}
+
+		stmts = append(stmts, strings.TrimSuffix(text, "\n"))
+	}
+
+	return stmts, inTx, nil
+}
+
+// replaySkippedKeywords are the first keywords of the statements that are not replayed:
+// the changes replicated by logical replication, the transaction control and the maintenance commands.
+var replaySkippedKeywords = map[string]bool{
+	"INSERT": true, "UPDATE": true, "DELETE": true, "MERGE": true, "COPY": true, "TRUNCATE": true,
+	"SELECT": true, "VALUES": true, "TABLE": true, "WITH": true,
+	"BEGIN": true, "START": true, "COMMIT": true, "END": true, "ROLLBACK": true, "ABORT": true,
+	"SAVEPOINT": true, "RELEASE": true, "LOCK": true,
+	"VACUUM": true, "ANALYZE": true, "EXPLAIN": true, "CHECKPOINT": true,
+	"LISTEN": true, "UNLISTEN": true, "NOTIFY": true,
+}
+
+func skipReplayStatement(stmt sqlStatement) bool {
+	if len(stmt.keywords) == 0 {
+		return true
+	}
+
+	// SELECT ... INTO creates a table like CREATE TABLE AS
+	if stmt.keywords[0] == "SELECT" && stmt.hasKeyword("INTO") {
+		return false
+	}
+
+	return replaySkippedKeywords[stmt.keywords[0]]
+}
+
+type sqlStatement struct {
+	text string
+
+	// keywords holds the upper-cased words outside the literals, the quoted identifiers and the comments.
+	keywords []string
+}
+
+func (s sqlStatement) hasKeyword(kw string) bool {
+	for _, k := range s.keywords {
+		if k == kw {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitSQLStatements splits the query string on the semicolons outside the literals, the quoted identifiers,
+// the dollar-quoted strings, the comments and the parentheses.
+func splitSQLStatements(query string) []sqlStatement {
+	var stmts []sqlStatement
+
+	isWord := func(c byte) bool {
+		return c == '_' || c == '$' || c >= 0x80 ||
+			('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+	}
+
+	var (
+		cur   sqlStatement
+		start int
+		depth int
+	)
+
+	flush := func(end int) {
+		cur.text = strings.TrimSpace(query[start:end])
+		if cur.text != "" {
+			stmts = append(stmts, cur)
+		}
+
+		cur = sqlStatement{}
+	}
+
+	for i := 0; i < len(query); {
+		c := query[i]
+
+		switch {
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+				i += j + 1
+			} else {
+				i = len(query)
+			}
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			i = scanBlockComment(query, i)
+		case c == '\'':
+			escaped := i > 0 && (query[i-1] == 'E' || query[i-1] == 'e') && (i < 2 || !isWord(query[i-2]))
+			i = scanSQLQuoted(query, i, '\'', escaped)
+		case c == '"':
+			i = scanSQLQuoted(query, i, '"', false)
+		case c == '$' && (i == 0 || !isWord(query[i-1])):
+			if tag := dollarQuoteTag(query[i:]); tag != "" {
+				if j := strings.Index(query[i+len(tag):], tag); j >= 0 {
+					i += len(tag) + j + len(tag)
+				} else {
+					i = len(query)
+				}
+			} else {
+				i++
+			}
+		case isWord(c):
+			end := i
+			for end < len(query) && isWord(query[end]) {
+				end++
+			}
+
+			cur.keywords = append(cur.keywords, strings.ToUpper(query[i:end]))
+			i = end
+		case c == '(':
+			depth++
+			i++
+		case c == ')':
+			depth--
+			i++
+		case c == ';' && depth <= 0:
+			flush(i + 1)
+			start = i + 1
+			i++
+		default:
+			i++
+		}
+	}
+
+	flush(len(query))
+
+	return stmts
+}
+
+// scanSQLQuoted returns the end of the quoted string starting at i. The doubled quotes are escaped quotes.
+func scanSQLQuoted(query string, i int, q byte, backslash bool) int {
+	for j := i + 1; j < len(query); j++ {
+		switch {
+		case backslash && query[j] == '\\':
+			j++
+		case query[j] != q:
+		case j+1 < len(query) && query[j+1] == q:
+			j++
+		default:
+			return j + 1
+		}
+	}
+
+	return len(query)
+}
+
+// scanBlockComment returns the end of the (nested) block comment starting at i.
+func scanBlockComment(query string, i int) int {
+	depth := 0
+
+	for i < len(query) {
+		switch {
+		case strings.HasPrefix(query[i:], "/*"):
+			depth++
+			i += 2
+		case strings.HasPrefix(query[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+
+	return i
+}
+
+// dollarQuoteTag returns the tag (e.g. $$ or $body$) if s starts with a dollar quote.
+func dollarQuoteTag(s string) string {
+	for j := 1; j < len(s); j++ {
+		c := s[j]
+
+		switch {
+		case c == '$':
+			return s[:j+1]
+		case c == '_' || c >= 0x80 || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z'):
+		case '0' <= c && c <= '9' && j > 1:
+		default:
+			return ""
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,79 @@
+package flare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitSQLStatements(t *testing.T) {
+	require := require.New(t)
+
+	query := `CREATE TABLE "a;b" (id int DEFAULT 1); -- comment;
+COMMENT ON TABLE "a;b" IS 'it''s; fine';
+/* block /* nested; */ comment */ CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;
+SELECT E'\'; still a literal';
+CREATE RULE r AS ON INSERT TO t DO ALSO (INSERT INTO u VALUES (1); INSERT INTO v VALUES (2))`
+
+	stmts := splitSQLStatements(query)
+
+	var texts []string
+	for _, s := range stmts {
+		texts = append(texts, s.text)
+	}
+
+	require.Equal([]string{
+		`CREATE TABLE "a;b" (id int DEFAULT 1);`,
+		`-- comment;
+COMMENT ON TABLE "a;b" IS 'it''s; fine';`,
+		`/* block /* nested; */ comment */ CREATE FUNCTION f() RETURNS int AS $body$ SELECT 1; $body$ LANGUAGE sql;`,
+		`SELECT E'\'; still a literal';`,
+		`CREATE RULE r AS ON INSERT TO t DO ALSO (INSERT INTO u VALUES (1); INSERT INTO v VALUES (2))`,
+	}, texts)
+
+	require.Equal([]string{"COMMENT", "ON", "TABLE", "IS"}, stmts[1].keywords)
+	require.Equal("CREATE", stmts[2].keywords[0])
+}
+
+func TestReplayStatements(t *testing.T) {
+	require := require.New(t)
+
+	t.Run("SkipDML", func(t *testing.T) {
+		stmts, inTx, err := replayStatements(
+			"BEGIN; ALTER TABLE t ADD COLUMN c int; UPDATE t SET c = 1; INSERT INTO t VALUES (1); SELECT 1; COMMIT;",
+			nil,
+		)
+		require.NoError(err)
+		require.True(inTx)
+		require.Equal([]string{"ALTER TABLE t ADD COLUMN c int;"}, stmts)
+	})
+
+	t.Run("SelectInto", func(t *testing.T) {
+		stmts, _, err := replayStatements("SELECT * INTO t2 FROM t;", nil)
+		require.NoError(err)
+		require.Equal([]string{"SELECT * INTO t2 FROM t;"}, stmts)
+	})
+
+	t.Run("Concurrently", func(t *testing.T) {
+		stmts, inTx, err := replayStatements(
+			"CREATE INDEX CONCURRENTLY t_c ON t (c); COMMENT ON INDEX t_c IS 'CONCURRENTLY';",
+			nil,
+		)
+		require.NoError(err)
+		require.False(inTx)
+		require.Len(stmts, 2)
+
+		_, inTx, err = replayStatements(`COMMENT ON TABLE t IS 'CONCURRENTLY'; CREATE INDEX "concurrently" ON t (c);`, nil)
+		require.NoError(err)
+		require.True(inTx)
+	})
+
+	t.Run("RoleMap", func(t *testing.T) {
+		stmts, _, err := replayStatements("ALTER TABLE t OWNER TO app; GRANT SELECT ON t TO app;", RoleMap{"app": "app_new"})
+		require.NoError(err)
+		require.Equal([]string{
+			`ALTER TABLE t OWNER TO "app_new";`,
+			`GRANT SELECT ON t TO "app_new";`,
+		}, stmts)
+	})
+}
@@ -1,14 +1,15 @@
 package flare
 
 import (
-	"bufio"
 	"bytes"
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/url"
 	"os"
 	"os/exec"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -76,51 +77,22 @@ func ReadReplicationStatus(ctx context.Context, conn *Conn, sysID, uuid string)
 	return nil
 }
 
-func StripRoleOptionsForRDS(roles string) (string, error) {
-	rr := strings.NewReplacer(
-		" NOSUPERUSER", "",
-		" NOREPLICATION", "",
-		//" NOBYPASSRLS", "",
-	)
-
-	r := strings.NewReader(roles)
-	scanner := bufio.NewScanner(r)
-
-	var b strings.Builder
-
-	for scanner.Scan() {
-		t := scanner.Text()
-		if strings.HasPrefix(t, "ALTER ROLE") {
-			t = rr.Replace(t)
-		}
-		fmt.Fprintf(&b, "%s\n", t)
-	}
-
-	if err := scanner.Err(); err != nil {
-		return "", fmt.Errorf("scanning the roles: %w", err)
-	}
-
-	return b.String(), nil
+type DumpSchemaOptions struct {
+	// NoTablespaces omits the tablespace assignments so the objects are created in the default tablespace.
+	NoTablespaces bool
 }
 
-func DumpRoles(ui UserInfo, noPasswords bool) (string, error) {
-	args := ui.PSQLArgs()
-	args.Args = []string{"--roles-only"}
-
-	if noPasswords {
-		args.Args = append(args.Args, "--no-role-passwords")
-	}
-
-	return PGDumpAll(args)
-}
-
-func DumpSchema(ui UserInfo, db string) (string, error) {
+func DumpSchema(ui UserInfo, db string, opts DumpSchemaOptions) (string, error) {
 	args := ui.PSQLArgs()
 	args.Args = []string{
 		"--schema-only",
 		"--create",
 	}
 
+	if opts.NoTablespaces {
+		args.Args = append(args.Args, "--no-tablespaces")
+	}
+
 	return PGDump(args, db)
 }
 
@@ -128,16 +100,30 @@ func CreatePublicationQuery(pubname string) string {
 	return fmt.Sprintf(`CREATE PUBLICATION %s FOR ALL TABLES;`, quoteIdentifier(pubname))
 }
 
-func AlterTableReplicaIdentityFull(tbl string) string {
-	return fmt.Sprintf(`ALTER TABLE %s REPLICA IDENTITY FULL;`, quoteIdentifier(tbl))
+func AlterTableReplicaIdentityFull(tbl QualifiedName) string {
+	return fmt.Sprintf(`ALTER TABLE %s REPLICA IDENTITY FULL;`, tbl.Quote())
 }
 
-func CreateSubscriptionQuery(subName, connInfo, pubName string) string {
+func CreateSubscriptionQuery(subName, connInfo, pubName string, passwordRequired bool) string {
+	var with string
+	if !passwordRequired {
+		with = ` WITH (password_required = false)`
+	}
+
 	return fmt.Sprintf(
-		`CREATE SUBSCRIPTION %s CONNECTION '%s' PUBLICATION %s;`,
+		`CREATE SUBSCRIPTION %s CONNECTION %s PUBLICATION %s%s;`,
 		quoteIdentifier(subName),
-		connInfo,
+		quoteLiteral(connInfo),
 		quoteIdentifier(pubName),
+		with,
+	)
+}
+
+func AlterSubscriptionConnectionQuery(subName, connInfo string) string {
+	return fmt.Sprintf(
+		`ALTER SUBSCRIPTION %s CONNECTION %s;`,
+		quoteIdentifier(subName),
+		quoteLiteral(connInfo),
 	)
 }
 
@@ -148,6 +134,42 @@ func DropSubscriptionQuery(subName string) string {
 	)
 }
 
+func DisableSubscriptionQuery(subName string) string {
+	return fmt.Sprintf(
+		`ALTER SUBSCRIPTION %s DISABLE;`,
+		quoteIdentifier(subName),
+	)
+}
+
+func DetachSubscriptionSlotQuery(subName string) string {
+	return fmt.Sprintf(
+		`ALTER SUBSCRIPTION %s SET (slot_name = NONE);`,
+		quoteIdentifier(subName),
+	)
+}
+
+func AlterSubscriptionSetPublicationQuery(subName, pubName string) string {
+	return fmt.Sprintf(
+		`ALTER SUBSCRIPTION %s SET PUBLICATION %s;`,
+		quoteIdentifier(subName),
+		quoteIdentifier(pubName),
+	)
+}
+
+func AlterSubscriptionRefreshPublicationQuery(subName string) string {
+	return fmt.Sprintf(
+		`ALTER SUBSCRIPTION %s REFRESH PUBLICATION;`,
+		quoteIdentifier(subName),
+	)
+}
+
+func AlterSubscriptionEnableQuery(subName string) string {
+	return fmt.Sprintf(
+		`ALTER SUBSCRIPTION %s ENABLE;`,
+		quoteIdentifier(subName),
+	)
+}
+
 func DropPublicationQuery(pubName string) string {
 	return fmt.Sprintf(
 		`DROP PUBLICATION %s;`,
@@ -177,17 +199,10 @@ func GrantAllOnDatabaseQuery(dbName, role string) string {
 	)
 }
 
-func GrantAllOnAllTablesQuery(role string) string {
-	return fmt.Sprintf(
-		`GRANT ALL ON ALL TABLES IN SCHEMA public TO %s;`,
-		quoteIdentifier(role),
-	)
-}
-
-func CountRecordsInTablesQuery(tableName string) string {
+func CountRecordsInTablesQuery(tbl QualifiedName) string {
 	return fmt.Sprintf(
 		`SELECT count(*) FROM %s`,
-		quoteIdentifier(tableName),
+		tbl.Quote(),
 	)
 }
 
@@ -208,14 +223,27 @@ const KillConnectionQuery = `
 	FROM pg_stat_activity
 	WHERE
 		  pid <> pg_backend_pid()
-	  AND usename = $1 -- only kill the application session
+	  AND usename = ANY($1) -- only kill the application sessions
 	  AND datname = $2
 	;`
 
+const DropReplicationSlotQuery = `SELECT pg_drop_replication_slot($1);`
+
 type Config struct {
 	Hosts         Hosts                   `yaml:"hosts"`
 	Publications  map[string]Publication  `yaml:"publications"`
-	Subscriptions map[string]Subscription `yaml:"subscriptions"`
+	Subscriptions map[string]Subscription `yaml:"subscriptions" validate:"dive"`
+
+	Providers map[string]ProviderProfile `yaml:"providers"`
+
+	// RoleMap renames the roles in the publisher when they are replicated to the subscriber.
+	RoleMap RoleMap `yaml:"role_map"`
+
+	// Tablespaces maps the tablespaces in the publisher to the ones in the subscriber.
+	Tablespaces TablespaceMap `yaml:"tablespaces"`
+
+	// Databases overrides the name and the options of the databases in the subscriber.
+	Databases map[string]DatabaseConfig `yaml:"databases"`
 }
 
 type Hosts struct {
@@ -225,18 +253,42 @@ type Hosts struct {
 
 type Host struct {
 	Conn ConnConfig `yaml:"conn"`
+
+	// Provider selects the managed service profile (e.g. rds, aurora, cloudsql, azure).
+	Provider string `yaml:"provider"`
 }
 
 type Publication struct {
-	PubName                   string   `yaml:"pubname"`
-	ReplicaIdentityFullTables []string `yaml:"replica_identity_full_tables"`
+	PubName                   string          `yaml:"pubname"`
+	ReplicaIdentityFullTables []QualifiedName `yaml:"replica_identity_full_tables"`
 }
 
 type Subscription struct {
 	DBName  string `yaml:"dbname"`
 	PubName string `yaml:"pubname"`
+
+	// PasswordMode is how the subscriber authenticates to the publisher:
+	// "embed" (default) puts the password in the connection string (readable in pg_subscription),
+	// "passfile" omits the password and uses Passfile (or ~/.pgpass) in the subscriber and
+	// "none" omits the password with password_required = false (superusers only, PostgreSQL 16 or later).
+	PasswordMode string `yaml:"password_mode" validate:"omitempty,oneof=embed passfile none"`
+	Passfile     string `yaml:"passfile"`
+
+	// Enabled is the desired state of the subscription in apply. The current state is kept when it is not set.
+	Enabled *bool `yaml:"enabled"`
+}
+
+// PasswordRequired returns false if the subscription is created with password_required = false.
+func (s Subscription) PasswordRequired() bool {
+	return s.PasswordMode != SubscriptionPasswordNone
 }
 
+const (
+	SubscriptionPasswordEmbed    = "embed"
+	SubscriptionPasswordPassfile = "passfile"
+	SubscriptionPasswordNone     = "none"
+)
+
 type HostInfo struct {
 	Host              string
 	HostViaSubscriber string
@@ -244,7 +296,16 @@ type HostInfo struct {
 	Port              string
 	PortViaSubscriber string
 
+	TLS              TLSConfig
+	TLSViaSubscriber TLSConfig
+
+	Service string
+	Params  map[string]string
+
 	SystemIdentifier string
+	Identity         IdentityConfig
+
+	tunnel *SSHTunnel
 }
 
 type UserInfo struct {
@@ -262,12 +323,7 @@ func (ui UserInfo) WithHostInfo(hi HostInfo) UserInfo {
 func (ui UserInfo) DSNURI(dbName string) string {
 	up := url.UserPassword(ui.User, ui.Password)
 
-	return fmt.Sprintf(
-		"postgres://%s@%s:%s/%s",
-		up.String(),
-		ui.hi.Host, ui.hi.Port,
-		dbName,
-	)
+	return buildURI(up, ui.hi.Host, ui.hi.Port, dbName, ui.hi.connParams())
 }
 
 func (ui UserInfo) DSNURIForSubscriber(dbName string) string {
@@ -283,32 +339,40 @@ func (ui UserInfo) DSNURIForSubscriber(dbName string) string {
 
 	up := url.UserPassword(ui.User, ui.Password)
 
-	return fmt.Sprintf(
-		"postgres://%s@%s:%s/%s",
-		up.String(),
-		host, port,
-		dbName,
-	)
+	return buildURI(up, host, port, dbName, ui.hi.subscriberParams())
 }
 
 func (ui UserInfo) PSQLArgs() PSQLArgs {
-	return PSQLArgs{
+	args := PSQLArgs{
 		User: ui.User,
 		Pass: ui.Password,
 		Host: ui.hi.Host,
 		Port: ui.hi.Port,
+		TLS:  ui.hi.TLS,
+
+		Service: ui.hi.Service,
+		Params:  ui.hi.Params,
+
+		hi: &ui.hi,
+	}
+
+	// the host is kept for TLS and the commands connect to the tunnel with PGHOSTADDR
+	if ui.hi.tunnel != nil {
+		args.HostAddr, args.Port = ui.hi.tunnel.LocalAddr()
 	}
+
+	return args
 }
 
 type ConnConfig struct {
 	SuperUser         string `yaml:"superuser" validate:"required"`
-	SuperUserPassword string `yaml:"superuser_password" validate:"required"`
+	SuperUserPassword Secret `yaml:"superuser_password" validate:"required"`
 
 	DBOwner         string `yaml:"db_owner" validate:"required"`
-	DBOwnerPassword string `yaml:"db_owner_password" validate:"required"`
+	DBOwnerPassword Secret `yaml:"db_owner_password" validate:"required"`
 
 	ReplicationUser         string `yaml:"repl_user"`
-	ReplicationUserPassword string `yaml:"repl_user_password"`
+	ReplicationUserPassword Secret `yaml:"repl_user_password"`
 
 	Host              string `yaml:"host" validate:"required"`
 	HostViaSubscriber string `yaml:"host_via_subscriber"`
@@ -316,7 +380,24 @@ type ConnConfig struct {
 	Port              string `yaml:"port" validate:"required"`
 	PortViaSubscriber string `yaml:"port_via_subscriber"`
 
+	TLS              TLSConfig `yaml:"tls"`
+	TLSViaSubscriber TLSConfig `yaml:"tls_via_subscriber"` // overrides TLS in the subscription
+
+	// SSHTunnel connects to the host through the bastion.
+	SSHTunnel *SSHTunnelConfig `yaml:"ssh_tunnel" validate:"omitempty"`
+
+	// Service is the service name in pg_service.conf. host and port in the config take precedence.
+	Service string `yaml:"service"`
+
+	// Params is the additional libpq parameters (e.g. application_name, options and target_session_attrs).
+	Params map[string]string `yaml:"params"`
+
 	SystemIdentifier string `yaml:"system_identifier" validate:"required"`
+
+	// Identity is the additional checks to identify the server.
+	Identity IdentityConfig `yaml:"identity"`
+
+	tunnel *SSHTunnel
 }
 
 func (c ConnConfig) GetHostInfo() HostInfo {
@@ -327,14 +408,23 @@ func (c ConnConfig) GetHostInfo() HostInfo {
 		Port:              c.Port,
 		PortViaSubscriber: c.PortViaSubscriber,
 
+		TLS:              c.TLS,
+		TLSViaSubscriber: c.TLSViaSubscriber,
+
+		Service: c.Service,
+		Params:  c.Params,
+
 		SystemIdentifier: c.SystemIdentifier,
+		Identity:         c.Identity,
+
+		tunnel: c.tunnel,
 	}
 }
 
 func (c ConnConfig) SuperUserInfo() UserInfo {
 	return UserInfo{
 		User:     c.SuperUser,
-		Password: c.SuperUserPassword,
+		Password: c.SuperUserPassword.Value,
 
 		hi: c.GetHostInfo(),
 	}
@@ -343,7 +433,7 @@ func (c ConnConfig) SuperUserInfo() UserInfo {
 func (c ConnConfig) DBOwnerInfo() UserInfo {
 	return UserInfo{
 		User:     c.DBOwner,
-		Password: c.DBOwnerPassword,
+		Password: c.DBOwnerPassword.Value,
 
 		hi: c.GetHostInfo(),
 	}
@@ -352,13 +442,39 @@ func (c ConnConfig) DBOwnerInfo() UserInfo {
 func (c ConnConfig) ReplicationUserInfo() UserInfo {
 	return UserInfo{
 		User:     c.ReplicationUser,
-		Password: c.ReplicationUserPassword,
+		Password: c.ReplicationUserPassword.Value,
 
 		hi: c.GetHostInfo(),
 	}
 }
 
 func ParseConfig(b []byte) (Config, error) {
+	return ParseConfigWithOptions(b, ValidateOptions{})
+}
+
+// ParseConfigWithOptions parses the config with the checks that depend on how the config is used.
+func ParseConfigWithOptions(b []byte, opts ValidateOptions) (Config, error) {
+	cfg, err := parseConfig(b, opts)
+	if err != nil {
+		return cfg, err
+	}
+
+	for _, c := range []*ConnConfig{&cfg.Hosts.Publisher.Conn, &cfg.Hosts.Subscriber.Conn} {
+		if err := c.ResolveSecrets(context.Background()); err != nil {
+			return cfg, err
+		}
+	}
+
+	return cfg, nil
+}
+
+// ValidateConfig validates the config in the same way as ParseConfig without resolving the secrets nor connecting.
+func ValidateConfig(b []byte, opts ValidateOptions) error {
+	_, err := parseConfig(b, opts)
+	return err
+}
+
+func parseConfig(b []byte, opts ValidateOptions) (Config, error) {
 	cfg := Config{}
 
 	if err := yaml.Unmarshal(b, &cfg); err != nil {
@@ -366,10 +482,25 @@ func ParseConfig(b []byte) (Config, error) {
 	}
 
 	validate := validator.New()
+	registerSecretType(validate)
 	if err := validate.Struct(cfg); err != nil {
 		return cfg, err
 	}
 
+	for _, h := range []Host{cfg.Hosts.Publisher, cfg.Hosts.Subscriber} {
+		if _, err := cfg.ProviderProfile(h); err != nil {
+			return cfg, err
+		}
+
+		if err := h.Conn.ValidateParams(); err != nil {
+			return cfg, err
+		}
+	}
+
+	if err := cfg.Validate(opts); err != nil {
+		return cfg, err
+	}
+
 	return cfg, nil
 }
 
@@ -378,7 +509,18 @@ type PSQLArgs struct {
 	Pass string
 	Host string
 	Port string
+	TLS  TLSConfig
+
+	// HostAddr is passed as PGHOSTADDR to connect to the address while the host is verified in TLS.
+	HostAddr string
+
+	Service string
+	Params  map[string]string
+
 	Args []string
+
+	// hi is used to verify the identity before running the commands. The identity isn't verified if it's nil.
+	hi *HostInfo
 }
 
 func (a PSQLArgs) BuildArgs() []string {
@@ -397,14 +539,101 @@ func (a PSQLArgs) BuildArgs() []string {
 	return append(args, a.Args...)
 }
 
+// ConnInfo returns the database name or the connection string with the service and the parameters for the database.
+// The database name is omitted if it's empty.
+func (a PSQLArgs) ConnInfo(db string) string {
+	if a.Service == "" && len(a.Params) == 0 {
+		return db
+	}
+
+	var params [][2]string
+
+	if db != "" {
+		params = append(params, [2]string{"dbname", db})
+	}
+
+	if a.Service != "" {
+		params = append(params, [2]string{"service", a.Service})
+	}
+
+	for _, k := range sortedKeys(a.Params) {
+		params = append(params, [2]string{k, a.Params[k]})
+	}
+
+	return buildConnInfo(params)
+}
+
+// Env returns the environment variables to run psql, pg_dump and pg_dumpall.
+func (a PSQLArgs) Env() []string {
+	env := []string{
+		fmt.Sprintf("PATH=%s", os.Getenv("PATH")),
+		fmt.Sprintf("PGPASSWORD=%s", a.Pass),
+	}
+
+	env = append(env, lookupEnv(passthroughEnv)...)
+
+	if a.HostAddr != "" {
+		env = append(env, fmt.Sprintf("PGHOSTADDR=%s", a.HostAddr))
+	}
+
+	return append(env, a.TLS.Env()...)
+}
+
+// verifiedEnv verifies the identity of the server and returns the environment variables to run the commands.
+// PGHOSTADDR is set to the verified address so that the commands connect to the same server.
+// The address doesn't pin the server behind a loopback address or the SSH tunnel
+// so psql verifies the identity again in its session and pg_dump and pg_dumpall verify it again after the dump,
+// which costs two extra connections per dump in exchange for not trusting the address.
+func (a PSQLArgs) verifiedEnv(db string) ([]string, error) {
+	env := a.Env()
+
+	addr, err := a.verify(db)
+	if err != nil {
+		return nil, err
+	}
+
+	if addr != "" && a.HostAddr == "" {
+		env = append(env, fmt.Sprintf("PGHOSTADDR=%s", addr))
+	}
+
+	return env, nil
+}
+
+// verify verifies the identity of the server and returns its IP address.
+func (a PSQLArgs) verify(db string) (string, error) {
+	if a.hi == nil {
+		return "", nil
+	}
+
+	if db == "" {
+		db = "postgres"
+	}
+
+	ctx := context.Background()
+
+	conn, err := Connect(ctx, UserInfo{User: a.User, Password: a.Pass, hi: *a.hi}, db)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close(ctx)
+
+	return conn.serverHostAddr(), nil
+}
+
 func PSQL(args PSQLArgs, db string, r io.Reader) (string, string, error) {
 	dumpArgs := []string{}
 	dumpArgs = append(dumpArgs, args.BuildArgs()...)
 
-	cmd := exec.Command("psql", append(dumpArgs, db)...)
-	cmd.Env = []string{
-		fmt.Sprintf("PATH=%s", os.Getenv("PATH")),
-		fmt.Sprintf("PGPASSWORD=%s", args.Pass),
+	env, err := args.verifiedEnv(db)
+	if err != nil {
+		return "", "", fmt.Errorf("psql: %w", err)
+	}
+
+	cmd := exec.Command("psql", append(dumpArgs, args.ConnInfo(db))...)
+	cmd.Env = env
+
+	if args.hi != nil {
+		r = io.MultiReader(strings.NewReader(args.hi.identityGuard()), r)
 	}
 
 	var out bytes.Buffer
@@ -424,12 +653,14 @@ func PGDump(args PSQLArgs, db string) (string, error) {
 	dumpArgs := []string{}
 	dumpArgs = append(dumpArgs, args.BuildArgs()...)
 
-	cmd := exec.Command("pg_dump", append(dumpArgs, db)...)
-	cmd.Env = []string{
-		fmt.Sprintf("PATH=%s", os.Getenv("PATH")),
-		fmt.Sprintf("PGPASSWORD=%s", args.Pass),
+	env, err := args.verifiedEnv(db)
+	if err != nil {
+		return "", fmt.Errorf("pg_dump: %w", err)
 	}
 
+	cmd := exec.Command("pg_dump", append(dumpArgs, args.ConnInfo(db))...)
+	cmd.Env = env
+
 	var out bytes.Buffer
 	var errout bytes.Buffer
 	cmd.Stdout = &out
@@ -439,6 +670,10 @@ func PGDump(args PSQLArgs, db string) (string, error) {
 		return "", fmt.Errorf("pg_dump: %w: %s", err, errout.String())
 	}
 
+	if _, err := args.verify(db); err != nil {
+		return "", fmt.Errorf("pg_dump: %w", err)
+	}
+
 	return out.String(), nil
 }
 
@@ -446,12 +681,18 @@ func PGDumpAll(args PSQLArgs) (string, error) {
 	dumpArgs := []string{}
 	dumpArgs = append(dumpArgs, args.BuildArgs()...)
 
-	cmd := exec.Command("pg_dumpall", dumpArgs...)
-	cmd.Env = []string{
-		fmt.Sprintf("PATH=%s", os.Getenv("PATH")),
-		fmt.Sprintf("PGPASSWORD=%s", args.Pass),
+	if ci := args.ConnInfo(""); ci != "" {
+		dumpArgs = append(dumpArgs, "--dbname="+ci)
+	}
+
+	env, err := args.verifiedEnv("")
+	if err != nil {
+		return "", fmt.Errorf("pg_dumpall: %w", err)
 	}
 
+	cmd := exec.Command("pg_dumpall", dumpArgs...)
+	cmd.Env = env
+
 	var out bytes.Buffer
 	var errout bytes.Buffer
 	cmd.Stdout = &out
@@ -461,6 +702,10 @@ func PGDumpAll(args PSQLArgs) (string, error) {
 		return "", fmt.Errorf("pg_dumpall: %w: %s", err, errout.String())
 	}
 
+	if _, err := args.verify(""); err != nil {
+		return "", fmt.Errorf("pg_dumpall: %w", err)
+	}
+
 	return out.String(), nil
 }
 
@@ -513,13 +758,19 @@ func (c *Conn) VerifySystemIdentifier(ctx context.Context) error {
 	return nil
 }
 
-func ConnectWithVerify(ctx context.Context, ui UserInfo, dbName string) (*Conn, error) {
-	fconn, err := Connect(ctx, ui, dbName)
+// Connect connects to the database and verifies the identity of the server.
+//
+// The identity is verified on every connection at the cost of a round trip (a query on the catalogs) per connection.
+// The verified servers aren't cached per host: the address a connection resolves to can't tell apart
+// the servers behind a loopback address, a port forward or the SSH tunnel, so a cached address could
+// let a destructive command run against a different server that took over the same address.
+func Connect(ctx context.Context, ui UserInfo, dbName string) (*Conn, error) {
+	fconn, err := ConnectWithoutVerify(ctx, ui, dbName)
 	if err != nil {
 		return nil, err
 	}
 
-	if err := fconn.VerifySystemIdentifier(ctx); err != nil {
+	if err := fconn.VerifyIdentity(ctx); err != nil {
 		defer fconn.Close(ctx)
 
 		return nil, fmt.Errorf("flare: verifying the identity: %w", err)
@@ -528,8 +779,38 @@ func ConnectWithVerify(ctx context.Context, ui UserInfo, dbName string) (*Conn,
 	return fconn, nil
 }
 
-func Connect(ctx context.Context, ui UserInfo, dbName string) (*Conn, error) {
-	conn, err := pgx.Connect(ctx, ui.DSNURI(dbName))
+// serverHostAddr returns the IP address of the server or an empty string for the Unix-domain socket.
+func (c *Conn) serverHostAddr() string {
+	if addr, ok := c.Conn.PgConn().Conn().RemoteAddr().(*net.TCPAddr); ok {
+		return addr.IP.String()
+	}
+
+	return ""
+}
+
+// pgxConfig returns the config to connect to the database from flare.
+func (ui UserInfo) pgxConfig(dbName string) (*pgx.ConnConfig, error) {
+	pcfg, err := pgx.ParseConfig(ui.DSNURI(dbName))
+	if err != nil {
+		return nil, err
+	}
+
+	if ui.hi.tunnel != nil {
+		ui.hi.tunnel.configure(&pcfg.Config)
+	}
+
+	return pcfg, nil
+}
+
+// ConnectWithoutVerify connects to the database without verifying the identity of the server.
+// It should be used only to inspect a server that doesn't match the config yet.
+func ConnectWithoutVerify(ctx context.Context, ui UserInfo, dbName string) (*Conn, error) {
+	pcfg, err := ui.pgxConfig(dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := pgx.ConnectConfig(ctx, pcfg)
 	if err != nil {
 		return nil, err
 	}
@@ -759,6 +1040,136 @@ ORDER BY slot_name
 	return slots, nil
 }
 
+func ListInactiveLogicalReplicationSlots(ctx context.Context, conn *Conn) ([]ReplicationSlot, error) {
+	rows, err := conn.Query(ctx, `
+SELECT slot_name, plugin, slot_type, database, temporary::text, active::text, confirmed_flush_lsn::text
+FROM pg_replication_slots
+WHERE slot_type = 'logical' AND NOT active
+ORDER BY slot_name
+;
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("querying the inactive replication slots: %w", err)
+	}
+
+	var slots []ReplicationSlot
+
+	for rows.Next() {
+		var sl ReplicationSlot
+		if err := rows.Scan(
+			&sl.SlotName,
+			&sl.Plugin,
+			&sl.SlotType,
+			&sl.Database,
+			&sl.Temporary,
+			&sl.Active,
+			&sl.ConfirmedFlushLSN,
+		); err != nil {
+			return nil, fmt.Errorf("scanning the slot: %w", err)
+		}
+
+		slots = append(slots, sl)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("scanning the slots: %w", err)
+	}
+
+	return slots, nil
+}
+
+// SubscriptionSlot is a subscription in the subscriber and the replication slot it uses in the publisher.
+type SubscriptionSlot struct {
+	OID      string
+	SubName  string
+	SlotName zeronull.Text
+}
+
+// ListSubscriptionSlots returns the subscriptions in all the databases of the subscriber.
+func ListSubscriptionSlots(ctx context.Context, conn *Conn) ([]SubscriptionSlot, error) {
+	rows, err := conn.Query(ctx, `SELECT oid::text, subname, subslotname::text FROM pg_subscription ORDER BY oid;`)
+	if err != nil {
+		return nil, fmt.Errorf("querying the subscriptions: %w", err)
+	}
+
+	var subs []SubscriptionSlot
+
+	for rows.Next() {
+		var sub SubscriptionSlot
+		if err := rows.Scan(&sub.OID, &sub.SubName, &sub.SlotName); err != nil {
+			return nil, fmt.Errorf("scanning the subscription: %w", err)
+		}
+
+		subs = append(subs, sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("scanning the subscriptions: %w", err)
+	}
+
+	return subs, nil
+}
+
+// tableSyncSlotRegexp matches the table synchronization slots: pg_<subscription oid>_sync_<relation oid>_<system identifier>.
+var tableSyncSlotRegexp = regexp.MustCompile(`^pg_([0-9]+)_sync_[0-9]+_([0-9]+)$`)
+
+// OrphanReplicationSlots returns the slots left behind by the subscriptions of the subscriber.
+// subs are the subscriptions that exist in the subscriber and subscriberSysID is its system identifier.
+//
+// A slot is an orphan only when flare knows which subscription it belonged to and the subscription no longer uses it:
+// the slot is named after a subscription in the config and no subscription in the subscriber uses it,
+// or it is a table synchronization slot created by the subscriber for a subscription that no longer exists.
+// The other slots (e.g. created by other consumers or with a custom slot_name) are never returned.
+func OrphanReplicationSlots(cfg Config, subscriberSysID string, subs []SubscriptionSlot, slots []ReplicationSlot) []ReplicationSlot {
+	inUse := map[string]bool{}
+	subOIDs := map[string]bool{}
+
+	for _, sub := range subs {
+		subOIDs[sub.OID] = true
+		if sub.SlotName != "" {
+			inUse[string(sub.SlotName)] = true
+		}
+	}
+
+	var orphans []ReplicationSlot
+
+	for _, sl := range slots {
+		if inUse[sl.SlotName] {
+			continue
+		}
+
+		if sub, ok := cfg.Subscriptions[sl.SlotName]; ok {
+			if sub.DBName == sl.Database {
+				orphans = append(orphans, sl)
+			}
+
+			continue
+		}
+
+		if m := tableSyncSlotRegexp.FindStringSubmatch(sl.SlotName); m != nil {
+			if m[2] == subscriberSysID && !subOIDs[m[1]] {
+				orphans = append(orphans, sl)
+			}
+		}
+	}
+
+	return orphans
+}
+
+func GetSubscriptionSlotName(ctx context.Context, conn *Conn, subName string) (string, error) {
+	var slotName zeronull.Text
+
+	if err := conn.QueryRow(
+		ctx,
+		`SELECT subslotname FROM pg_subscription WHERE subname = $1;`,
+		subName,
+	).Scan(&slotName); err != nil {
+		return "", fmt.Errorf("querying the slot name of the subscription: %w", err)
+	}
+
+	return string(slotName), nil
+}
+
 type SubscriptionStat struct {
 	SubID       string
 	SubName     string
@@ -814,3 +1225,13 @@ ORDER BY subid
 func quoteIdentifier(s string) string {
 	return `"` + strings.ReplaceAll(s, `"`, `""`) + `"`
 }
+
+// quoteLiteral quotes the string in the same way as quote_literal in PostgreSQL.
+func quoteLiteral(s string) string {
+	q := `'` + strings.ReplaceAll(s, `'`, `''`) + `'`
+	if !strings.Contains(s, `\`) {
+		return q
+	}
+
+	return `E` + strings.ReplaceAll(q, `\`, `\\`)
+}
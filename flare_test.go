@@ -4,6 +4,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -42,6 +43,25 @@ hosts:
 		err,
 		"Key: 'Config.Hosts.Publisher.Conn.SystemIdentifier' Error:Field validation for 'SystemIdentifier' failed on the 'required' tag",
 	)
+
+	_, err = ParseConfig([]byte(strings.Replace(string(mustReadTestData("example.yml")), "superuser_password: 'password1'", "superuser_password: ''", 1)))
+	require.EqualError(
+		err,
+		"Key: 'Config.Hosts.Publisher.Conn.SuperUserPassword' Error:Field validation for 'SuperUserPassword' failed on the 'required' tag",
+	)
+
+	cfg = append(mustReadTestData("example.yml"), `
+  benchsub3:
+    dbname: pubtable1
+    pubname: publication1-name
+    password_mode: embedded
+`...)
+
+	_, err = ParseConfig(cfg)
+	require.EqualError(
+		err,
+		"Key: 'Config.Subscriptions[benchsub3].PasswordMode' Error:Field validation for 'PasswordMode' failed on the 'oneof' tag",
+	)
 }
 
 func TestConfig(t *testing.T) {
@@ -52,13 +72,13 @@ func TestConfig(t *testing.T) {
 			Publisher: Host{
 				Conn: ConnConfig{
 					SuperUser:         "postgres1",
-					SuperUserPassword: "password1",
+					SuperUserPassword: Secret{Value: "password1"},
 
 					DBOwner:         "owner",
-					DBOwnerPassword: "owner",
+					DBOwnerPassword: Secret{Value: "owner"},
 
 					ReplicationUser:         "repl",
-					ReplicationUserPassword: "repl",
+					ReplicationUserPassword: Secret{Value: "repl"},
 
 					Host:              "publisher",
 					HostViaSubscriber: "publisher_sub",
@@ -71,10 +91,10 @@ func TestConfig(t *testing.T) {
 			Subscriber: Host{
 				Conn: ConnConfig{
 					SuperUser:         "postgres2",
-					SuperUserPassword: "password2",
+					SuperUserPassword: Secret{Value: "password2"},
 
 					DBOwner:         "owner",
-					DBOwnerPassword: "owner",
+					DBOwnerPassword: Secret{Value: "owner"},
 
 					Host:             "subscriber",
 					Port:             "5431",
@@ -85,14 +105,14 @@ func TestConfig(t *testing.T) {
 		Publications: map[string]Publication{
 			"pubtable1": {
 				PubName: "publication1-name",
-				ReplicaIdentityFullTables: []string{
-					"full1", "full2",
+				ReplicaIdentityFullTables: []QualifiedName{
+					{Name: "full1"}, {Schema: "sales", Name: "full2"},
 				},
 			},
 			"pubtable2": {
 				PubName: "publication2-name",
-				ReplicaIdentityFullTables: []string{
-					"full3", "full4",
+				ReplicaIdentityFullTables: []QualifiedName{
+					{Name: "full3"}, {Name: "full4"},
 				},
 			},
 		},
@@ -182,7 +202,7 @@ func TestConn(t *testing.T) {
 
 	publisher := ConnConfig{
 		SuperUser:         "postgres",
-		SuperUserPassword: "password1",
+		SuperUserPassword: Secret{Value: "password1"},
 		Host:              "localhost",
 		Port:              "5430",
 		SystemIdentifier:  "12345",
@@ -191,7 +211,7 @@ func TestConn(t *testing.T) {
 	ctx := context.TODO()
 
 	t.Run("Ping", func(t *testing.T) {
-		conn, err := Connect(ctx, publisher.SuperUserInfo(), "postgres")
+		conn, err := ConnectWithoutVerify(ctx, publisher.SuperUserInfo(), "postgres")
 		require.NoError(err)
 
 		defer conn.Close(ctx)
@@ -200,7 +220,7 @@ func TestConn(t *testing.T) {
 	})
 
 	t.Run("Verify/Error", func(t *testing.T) {
-		conn, err := Connect(ctx, publisher.SuperUserInfo(), "postgres")
+		conn, err := ConnectWithoutVerify(ctx, publisher.SuperUserInfo(), "postgres")
 		require.NoError(err)
 
 		defer conn.Close(ctx)
@@ -209,8 +229,16 @@ func TestConn(t *testing.T) {
 		require.ErrorAs(verr, &SystemIdentifierError{})
 	})
 
+	t.Run("Connect/Error", func(t *testing.T) {
+		_, err := Connect(ctx, publisher.SuperUserInfo(), "postgres")
+		require.ErrorAs(err, &SystemIdentifierError{})
+
+		_, err = PGDump(publisher.SuperUserInfo().PSQLArgs(), "postgres")
+		require.ErrorAs(err, &SystemIdentifierError{})
+	})
+
 	t.Run("Verify/Verified", func(t *testing.T) {
-		conn1, err := Connect(ctx, publisher.SuperUserInfo(), "postgres")
+		conn1, err := ConnectWithoutVerify(ctx, publisher.SuperUserInfo(), "postgres")
 		require.NoError(err)
 
 		defer conn1.Close(ctx)
@@ -223,7 +251,7 @@ func TestConn(t *testing.T) {
 			ctx,
 			ConnConfig{
 				SuperUser:         "postgres",
-				SuperUserPassword: "password1",
+				SuperUserPassword: Secret{Value: "password1"},
 				Host:              "localhost",
 				Port:              "5430",
 				SystemIdentifier:  correctIden,
@@ -239,23 +267,62 @@ func TestConn(t *testing.T) {
 	})
 }
 
-func TestStripRoleOptionsForRDS(t *testing.T) {
-	input := `CREATE ROLE app;
-ALTER ROLE app WITH NOSUPERUSER INHERIT NOCREATEROLE NOCREATEDB LOGIN NOREPLICATION NOBYPASSRLS;
-CREATE ROLE dbowner;
-ALTER ROLE dbowner WITH NOSUPERUSER INHERIT NOCREATEROLE CREATEDB LOGIN NOREPLICATION NOBYPASSRLS;
-`
-	expected := `CREATE ROLE app;
-ALTER ROLE app WITH INHERIT NOCREATEROLE NOCREATEDB LOGIN NOBYPASSRLS;
-CREATE ROLE dbowner;
-ALTER ROLE dbowner WITH INHERIT NOCREATEROLE CREATEDB LOGIN NOBYPASSRLS;
-`
-
+func TestOrphanReplicationSlots(t *testing.T) {
 	require := require.New(t)
 
-	actual, err := StripRoleOptionsForRDS(input)
-	require.NoError(err)
-	require.Equal(expected, actual)
+	cfg := Config{
+		Subscriptions: map[string]Subscription{
+			"bench0": {DBName: "bench", PubName: "bench"},
+			"bench1": {DBName: "bench", PubName: "bench"},
+			"bench2": {DBName: "bench", PubName: "bench"},
+		},
+	}
+
+	subs := []SubscriptionSlot{
+		{OID: "16400", SubName: "bench1", SlotName: "bench1"},
+		{OID: "16401", SubName: "bench2", SlotName: "custom_slot"},
+		{OID: "16402", SubName: "detached"},
+	}
+
+	t.Run("Subscription", func(t *testing.T) {
+		slots := []ReplicationSlot{
+			{SlotName: "bench0", Database: "bench"},
+			{SlotName: "bench1", Database: "bench"},
+		}
+
+		require.Equal([]ReplicationSlot{{SlotName: "bench0", Database: "bench"}}, OrphanReplicationSlots(cfg, "12345", subs, slots))
+	})
+
+	t.Run("TableSync", func(t *testing.T) {
+		slots := []ReplicationSlot{
+			{SlotName: "pg_16400_sync_16390_12345", Database: "bench"},
+			{SlotName: "pg_16399_sync_16390_12345", Database: "bench"},
+			{SlotName: "pg_16399_sync_16390_67890", Database: "bench"},
+		}
+
+		require.Equal(
+			[]ReplicationSlot{{SlotName: "pg_16399_sync_16390_12345", Database: "bench"}},
+			OrphanReplicationSlots(cfg, "12345", subs, slots),
+		)
+	})
+
+	t.Run("CustomSlotName", func(t *testing.T) {
+		slots := []ReplicationSlot{
+			{SlotName: "custom_slot", Database: "bench"},
+			{SlotName: "bench2", Database: "bench"},
+		}
+
+		require.Equal([]ReplicationSlot{{SlotName: "bench2", Database: "bench"}}, OrphanReplicationSlots(cfg, "12345", subs, slots))
+	})
+
+	t.Run("Foreign", func(t *testing.T) {
+		slots := []ReplicationSlot{
+			{SlotName: "debezium", Database: "bench"},
+			{SlotName: "bench0", Database: "other"},
+		}
+
+		require.Empty(OrphanReplicationSlots(cfg, "12345", subs, slots))
+	})
 }
 
 func mustReadTestData(fn string) []byte {
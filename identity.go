@@ -0,0 +1,183 @@
+package flare
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// IdentityMarkerSetting is the setting on the postgres database to store the marker written by init_identity.
+const IdentityMarkerSetting = "flare.identity"
+
+// IdentityConfig is the additional checks to identify the server on top of system_identifier.
+// It tells apart the servers sharing system_identifier (e.g. a subscriber built from a snapshot of the publisher).
+type IdentityConfig struct {
+	ClusterName string `yaml:"cluster_name"`
+
+	// ServerVersion matches the version or the prefix of the version (e.g. "14" matches "14.4").
+	ServerVersion string `yaml:"server_version"`
+
+	// ServerAddr is the address returned by inet_server_addr().
+	ServerAddr string `yaml:"server_addr"`
+
+	// Marker is the marker written by init_identity.
+	Marker string `yaml:"marker"`
+}
+
+// Identity is the identity of the server.
+type Identity struct {
+	SystemIdentifier string
+	ClusterName      string
+	ServerVersion    string
+	ServerAddr       string
+	Marker           string
+}
+
+var getIdentityQuery = `
+SELECT
+  (SELECT system_identifier FROM pg_control_system())::text,
+  current_setting('cluster_name'),
+  current_setting('server_version'),
+  COALESCE(host(inet_server_addr()), ''),
+  COALESCE((
+    SELECT substring(c FROM length($1::text) + 2)
+    FROM pg_db_role_setting s
+    JOIN pg_database d ON d.oid = s.setdatabase
+    CROSS JOIN unnest(s.setconfig) c
+    WHERE d.datname = 'postgres' AND s.setrole = 0 AND c LIKE $1::text || '=%'
+  ), '')
+;
+`
+
+// GetIdentity returns the identity of the server in a single round trip.
+func (c *Conn) GetIdentity(ctx context.Context) (Identity, error) {
+	var id Identity
+
+	if err := c.Conn.QueryRow(ctx, getIdentityQuery, IdentityMarkerSetting).Scan(
+		&id.SystemIdentifier,
+		&id.ClusterName,
+		&id.ServerVersion,
+		&id.ServerAddr,
+		&id.Marker,
+	); err != nil {
+		return id, fmt.Errorf("querying the identity: %w", err)
+	}
+
+	return id, nil
+}
+
+// IdentityError is returned when the server doesn't match a check in the identity config.
+type IdentityError struct {
+	Check    string
+	Expected string
+	Got      string
+}
+
+func (e IdentityError) Error() string {
+	return fmt.Sprintf("flare: %s doesn't match! Got '%s', expected '%s'", e.Check, e.Got, e.Expected)
+}
+
+// VerifyIdentity verifies system_identifier and all the checks in the identity config.
+func (c *Conn) VerifyIdentity(ctx context.Context) error {
+	id, err := c.GetIdentity(ctx)
+	if err != nil {
+		return err
+	}
+
+	return c.userInfo.hi.verifyIdentity(id)
+}
+
+func (hi HostInfo) verifyIdentity(id Identity) error {
+	if hi.SystemIdentifier != id.SystemIdentifier {
+		return SystemIdentifierError{
+			Expected: hi.SystemIdentifier,
+			Got:      id.SystemIdentifier,
+		}
+	}
+
+	ic := hi.Identity
+
+	for _, check := range []struct {
+		name     string
+		expected string
+		got      string
+		match    func(expected, got string) bool
+	}{
+		{name: "cluster_name", expected: ic.ClusterName, got: id.ClusterName},
+		{name: "server_version", expected: ic.ServerVersion, got: id.ServerVersion, match: matchServerVersion},
+		{name: "server_addr", expected: ic.ServerAddr, got: id.ServerAddr},
+		{name: "marker", expected: ic.Marker, got: id.Marker},
+	} {
+		if check.expected == "" {
+			continue
+		}
+
+		match := check.match
+		if match == nil {
+			match = func(expected, got string) bool { return expected == got }
+		}
+
+		if !match(check.expected, check.got) {
+			return IdentityError{Check: check.name, Expected: check.expected, Got: check.got}
+		}
+	}
+
+	return nil
+}
+
+// matchServerVersion matches server_version (e.g. "14.4 (Debian 14.4-1.pgdg110+1)") with the version or its prefix.
+func matchServerVersion(expected, got string) bool {
+	version := strings.Fields(got)
+	if len(version) == 0 {
+		return false
+	}
+
+	return version[0] == expected || strings.HasPrefix(version[0], expected+".")
+}
+
+// identityGuard returns the psql commands to stop the script unless the server in the session matches the identity.
+func (hi HostInfo) identityGuard() string {
+	conds := []string{
+		fmt.Sprintf("(SELECT system_identifier FROM pg_control_system())::text = %s", quoteLiteral(hi.SystemIdentifier)),
+	}
+
+	ic := hi.Identity
+
+	if ic.ClusterName != "" {
+		conds = append(conds, fmt.Sprintf("current_setting('cluster_name') = %s", quoteLiteral(ic.ClusterName)))
+	}
+
+	if v := ic.ServerVersion; v != "" {
+		conds = append(conds, fmt.Sprintf(
+			"(split_part(current_setting('server_version'), ' ', 1) = %s OR left(current_setting('server_version'), %d) = %s)",
+			quoteLiteral(v), len(v)+1, quoteLiteral(v+"."),
+		))
+	}
+
+	if ic.ServerAddr != "" {
+		conds = append(conds, fmt.Sprintf("COALESCE(host(inet_server_addr()), '') = %s", quoteLiteral(ic.ServerAddr)))
+	}
+
+	if ic.Marker != "" {
+		conds = append(conds, fmt.Sprintf(`COALESCE((
+  SELECT substring(c FROM length(%[1]s) + 2)
+  FROM pg_db_role_setting s
+  JOIN pg_database d ON d.oid = s.setdatabase
+  CROSS JOIN unnest(s.setconfig) c
+  WHERE d.datname = 'postgres' AND s.setrole = 0 AND c LIKE %[1]s || '=%%'
+), '') = %[2]s`, quoteLiteral(IdentityMarkerSetting), quoteLiteral(ic.Marker)))
+	}
+
+	return fmt.Sprintf(`SELECT %s AS flare_identity_verified \gset
+\if :flare_identity_verified
+\else
+\set ON_ERROR_STOP on
+DO $$ BEGIN RAISE EXCEPTION 'flare: the server doesn''t match the identity in the config'; END $$;
+\endif
+`, strings.Join(conds, "\n  AND "))
+}
+
+// SetIdentityMarkerQuery writes the marker to the postgres database so that it can be read from any database.
+func SetIdentityMarkerQuery(marker string) string {
+	return fmt.Sprintf(`ALTER DATABASE postgres SET %s = %s;`, IdentityMarkerSetting, quoteLiteral(marker))
+}
@@ -0,0 +1,71 @@
+package flare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyIdentity(t *testing.T) {
+	require := require.New(t)
+
+	id := Identity{
+		SystemIdentifier: "12345",
+		ClusterName:      "main",
+		ServerVersion:    "14.4 (Debian 14.4-1.pgdg110+1)",
+		ServerAddr:       "10.0.0.10",
+		Marker:           "b7f1c1c2",
+	}
+
+	hi := HostInfo{SystemIdentifier: "12345"}
+	require.NoError(hi.verifyIdentity(id))
+
+	hi.Identity = IdentityConfig{
+		ClusterName:   "main",
+		ServerVersion: "14",
+		ServerAddr:    "10.0.0.10",
+		Marker:        "b7f1c1c2",
+	}
+	require.NoError(hi.verifyIdentity(id))
+
+	hi.Identity.ServerVersion = "14.4"
+	require.NoError(hi.verifyIdentity(id))
+
+	hi.Identity.ServerVersion = "1"
+	require.Equal(
+		IdentityError{Check: "server_version", Expected: "1", Got: "14.4 (Debian 14.4-1.pgdg110+1)"},
+		hi.verifyIdentity(id),
+	)
+
+	hi.Identity.ServerVersion = ""
+	hi.Identity.Marker = "other"
+	require.EqualError(hi.verifyIdentity(id), "flare: marker doesn't match! Got 'b7f1c1c2', expected 'other'")
+
+	hi.SystemIdentifier = "67890"
+	require.ErrorAs(hi.verifyIdentity(id), &SystemIdentifierError{})
+}
+
+func TestIdentityGuard(t *testing.T) {
+	require := require.New(t)
+
+	hi := HostInfo{SystemIdentifier: "12345"}
+	require.Equal(`SELECT (SELECT system_identifier FROM pg_control_system())::text = '12345' AS flare_identity_verified \gset
+\if :flare_identity_verified
+\else
+\set ON_ERROR_STOP on
+DO $$ BEGIN RAISE EXCEPTION 'flare: the server doesn''t match the identity in the config'; END $$;
+\endif
+`, hi.identityGuard())
+
+	hi.Identity = IdentityConfig{ClusterName: "main", ServerVersion: "14", ServerAddr: "10.0.0.10", Marker: "it's"}
+	guard := hi.identityGuard()
+	require.Contains(guard, `AND current_setting('cluster_name') = 'main'`)
+	require.Contains(guard, `AND (split_part(current_setting('server_version'), ' ', 1) = '14' OR left(current_setting('server_version'), 3) = '14.')`)
+	require.Contains(guard, `AND COALESCE(host(inet_server_addr()), '') = '10.0.0.10'`)
+	require.Contains(guard, `c LIKE 'flare.identity' || '=%'
+), '') = 'it''s' AS flare_identity_verified \gset`)
+}
+
+func TestSetIdentityMarkerQuery(t *testing.T) {
+	require.Equal(t, `ALTER DATABASE postgres SET flare.identity = 'it''s';`, SetIdentityMarkerQuery("it's"))
+}
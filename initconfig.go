@@ -0,0 +1,196 @@
+package flare
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// DiscoveredDatabase is a database found in the publisher by init.
+type DiscoveredDatabase struct {
+	Name string
+	Size int64
+
+	// TablesWithoutPrimaryKey are the tables that can't replicate UPDATE and DELETE without REPLICA IDENTITY FULL.
+	TablesWithoutPrimaryKey []QualifiedName
+}
+
+var listDatabasesQuery = `
+SELECT datname, pg_database_size(oid)
+FROM pg_database
+WHERE NOT datistemplate AND datallowconn
+ORDER BY datname
+;
+`
+
+// ListDatabases lists the non-template databases with the sizes.
+func ListDatabases(ctx context.Context, conn *Conn) ([]DiscoveredDatabase, error) {
+	rows, err := conn.Query(ctx, listDatabasesQuery)
+	if err != nil {
+		return nil, fmt.Errorf("listing the databases: %w", err)
+	}
+	defer rows.Close()
+
+	var ret []DiscoveredDatabase
+
+	for rows.Next() {
+		var db DiscoveredDatabase
+		if err := rows.Scan(&db.Name, &db.Size); err != nil {
+			return nil, fmt.Errorf("scanning the database: %w", err)
+		}
+
+		ret = append(ret, db)
+	}
+
+	return ret, rows.Err()
+}
+
+// the tables using the default replica identity without a primary key
+var listTablesWithoutPrimaryKeyQuery = `
+SELECT n.nspname, c.relname
+FROM pg_class c
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE
+  c.relkind IN ('r', 'p')
+  AND NOT c.relispartition
+  AND c.relpersistence = 'p'
+  AND c.relreplident = 'd'
+  AND n.nspname NOT IN ('pg_catalog', 'information_schema')
+  AND n.nspname NOT LIKE 'pg_toast%'
+  AND NOT EXISTS (SELECT 1 FROM pg_constraint con WHERE con.conrelid = c.oid AND con.contype = 'p')
+  AND NOT EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = c.oid AND d.deptype = 'e')
+ORDER BY n.nspname, c.relname
+;
+`
+
+// ListTablesWithoutPrimaryKey lists the tables that need REPLICA IDENTITY FULL in the database.
+func ListTablesWithoutPrimaryKey(ctx context.Context, conn *Conn) ([]QualifiedName, error) {
+	rows, err := conn.Query(ctx, listTablesWithoutPrimaryKeyQuery)
+	if err != nil {
+		return nil, fmt.Errorf("listing the tables without a primary key: %w", err)
+	}
+	defer rows.Close()
+
+	var ret []QualifiedName
+
+	for rows.Next() {
+		var tbl QualifiedName
+		if err := rows.Scan(&tbl.Schema, &tbl.Name); err != nil {
+			return nil, fmt.Errorf("scanning the table: %w", err)
+		}
+
+		ret = append(ret, tbl)
+	}
+
+	return ret, rows.Err()
+}
+
+// ExcludedDatabases are the databases that init doesn't replicate by default.
+var ExcludedDatabases = []string{"postgres", "rdsadmin", "cloudsqladmin", "azure_maintenance", "azure_sys"}
+
+// MajorVersion returns the major version in server_version (e.g. "14" for "14.4 (Debian 14.4-1.pgdg110+1)").
+func MajorVersion(serverVersion string) string {
+	fields := strings.Fields(serverVersion)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	parts := strings.Split(fields[0], ".")
+
+	// 9.6 and earlier have the major version in the first two parts
+	if parts[0] == "9" && len(parts) > 1 {
+		return parts[0] + "." + parts[1]
+	}
+
+	return parts[0]
+}
+
+// GenerateConfig returns the config to replicate the databases with a publication and a subscription for each.
+func GenerateConfig(hosts Hosts, dbs []DiscoveredDatabase) Config {
+	cfg := Config{
+		Hosts:         hosts,
+		Publications:  map[string]Publication{},
+		Subscriptions: map[string]Subscription{},
+	}
+
+	for _, db := range dbs {
+		cfg.Publications[db.Name] = Publication{
+			PubName:                   db.Name,
+			ReplicaIdentityFullTables: db.TablesWithoutPrimaryKey,
+		}
+
+		cfg.Subscriptions[db.Name+"_sub"] = Subscription{
+			DBName:  db.Name,
+			PubName: db.Name,
+		}
+	}
+
+	return cfg
+}
+
+// MarshalConfig marshals the config into YAML without the empty fields.
+func MarshalConfig(cfg Config) ([]byte, error) {
+	b, err := yaml.Marshal(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling the config: %w", err)
+	}
+
+	var ms yaml.MapSlice
+	if err := yaml.UnmarshalWithOptions(b, &ms, yaml.UseOrderedMap()); err != nil {
+		return nil, fmt.Errorf("unmarshaling the config: %w", err)
+	}
+
+	pruned, _ := pruneEmpty(ms).(yaml.MapSlice)
+
+	return yaml.MarshalWithOptions(pruned, yaml.IndentSequence(true))
+}
+
+func pruneEmpty(v interface{}) interface{} {
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		var ret yaml.MapSlice
+		for _, item := range v {
+			if pv := pruneEmpty(item.Value); pv != nil {
+				ret = append(ret, yaml.MapItem{Key: item.Key, Value: pv})
+			}
+		}
+		if len(ret) == 0 {
+			return nil
+		}
+		return ret
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		return v
+	case string:
+		if v == "" {
+			return nil
+		}
+		return v
+	case bool:
+		if !v {
+			return nil
+		}
+		return v
+	case nil:
+		return nil
+	default:
+		return v
+	}
+}
+
+// FormatSize formats the size in bytes like pg_size_pretty.
+func FormatSize(size int64) string {
+	units := []string{"bytes", "kB", "MB", "GB", "TB"}
+
+	i := 0
+	for size >= 10*1024 && i < len(units)-1 {
+		size = (size + 512) / 1024
+		i++
+	}
+
+	return fmt.Sprintf("%d %s", size, units[i])
+}
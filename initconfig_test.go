@@ -0,0 +1,111 @@
+package flare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateConfig(t *testing.T) {
+	require := require.New(t)
+
+	hosts := Hosts{
+		Publisher: Host{
+			Conn: ConnConfig{
+				SuperUser:         "postgres",
+				SuperUserPassword: Secret{From: SecretFromEnv, Value: "PUBLISHER_PASSWORD"},
+				DBOwner:           "postgres",
+				DBOwnerPassword:   Secret{From: SecretFromEnv, Value: "PUBLISHER_PASSWORD"},
+				Host:              "publisher",
+				Port:              "5432",
+				SystemIdentifier:  "12345",
+				Identity:          IdentityConfig{ServerVersion: "10"},
+			},
+			Provider: "rds",
+		},
+		Subscriber: Host{
+			Conn: ConnConfig{
+				SuperUser:         "postgres",
+				SuperUserPassword: Secret{Value: "password"},
+				DBOwner:           "postgres",
+				DBOwnerPassword:   Secret{Value: "password"},
+				Host:              "subscriber",
+				Port:              "5432",
+				SystemIdentifier:  "67890",
+				Identity:          IdentityConfig{ServerVersion: "14"},
+			},
+		},
+	}
+
+	cfg := GenerateConfig(hosts, []DiscoveredDatabase{
+		{Name: "bench", TablesWithoutPrimaryKey: []QualifiedName{{Schema: "public", Name: "pgbench_history"}, {Schema: "sales", Name: "events"}}},
+		{Name: "app"},
+	})
+
+	b, err := MarshalConfig(cfg)
+	require.NoError(err)
+	require.Equal(`hosts:
+  publisher:
+    conn:
+      superuser: postgres
+      superuser_password:
+        from: env
+        value: PUBLISHER_PASSWORD
+      db_owner: postgres
+      db_owner_password:
+        from: env
+        value: PUBLISHER_PASSWORD
+      host: publisher
+      port: "5432"
+      system_identifier: "12345"
+      identity:
+        server_version: "10"
+    provider: rds
+  subscriber:
+    conn:
+      superuser: postgres
+      superuser_password: password
+      db_owner: postgres
+      db_owner_password: password
+      host: subscriber
+      port: "5432"
+      system_identifier: "67890"
+      identity:
+        server_version: "14"
+publications:
+  app:
+    pubname: app
+  bench:
+    pubname: bench
+    replica_identity_full_tables:
+      - public.pgbench_history
+      - sales.events
+subscriptions:
+  app_sub:
+    dbname: app
+    pubname: app
+  bench_sub:
+    dbname: bench
+    pubname: bench
+`, string(b))
+
+	require.NoError(ValidateConfig(b, ValidateOptions{}))
+}
+
+func TestMajorVersion(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("14", MajorVersion("14.4 (Debian 14.4-1.pgdg110+1)"))
+	require.Equal("10", MajorVersion("10.21"))
+	require.Equal("9.6", MajorVersion("9.6.24"))
+	require.Equal("", MajorVersion(""))
+}
+
+func TestFormatSize(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal("8191 bytes", FormatSize(8191))
+	require.Equal("10 kB", FormatSize(10*1024))
+	require.Equal("7953 kB", FormatSize(8143442))
+	require.Equal("12 GB", FormatSize(12*1024*1024*1024))
+}
@@ -0,0 +1,239 @@
+package flare
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// copyBufferSize is large enough to reduce the round trips of loread/lowrite.
+const copyBufferSize = 1 << 20
+
+type LargeObject struct {
+	OID   uint32
+	Owner string
+
+	// ACL holds aclitem in the text form (e.g. `alice=rw/postgres`).
+	ACL []string
+
+	// Size is the number of bytes stored in pg_largeobject.
+	// It is 0 for the metadata-only large objects that pg_dump --schema-only creates.
+	Size int64
+
+	// MD5 is the checksum of the content to tell apart the large objects with the same size.
+	MD5 string
+}
+
+func CountLargeObjects(ctx context.Context, conn *Conn) (int64, error) {
+	var count int64
+
+	if err := conn.QueryRow(ctx, `SELECT count(*) FROM pg_largeobject_metadata;`).Scan(&count); err != nil {
+		return 0, fmt.Errorf("counting the large objects: %w", err)
+	}
+
+	return count, nil
+}
+
+func ListLargeObjects(ctx context.Context, conn *Conn) ([]LargeObject, error) {
+	rows, err := conn.Query(ctx, `
+SELECT m.oid::bigint, pg_get_userbyid(m.lomowner), COALESCE(m.lomacl::text[], '{}'), COALESCE(d.size, 0), md5(lo_get(m.oid))
+FROM pg_largeobject_metadata m
+LEFT JOIN (
+  SELECT loid, sum(octet_length(data)) AS size FROM pg_largeobject GROUP BY loid
+) d ON d.loid = m.oid
+ORDER BY m.oid
+;
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("querying the large objects: %w", err)
+	}
+
+	var los []LargeObject
+
+	for rows.Next() {
+		var (
+			oid int64
+			lo  LargeObject
+		)
+
+		if err := rows.Scan(&oid, &lo.Owner, &lo.ACL, &lo.Size, &lo.MD5); err != nil {
+			return nil, fmt.Errorf("scanning the large object: %w", err)
+		}
+
+		lo.OID = uint32(oid)
+
+		los = append(los, lo)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("scanning the large objects: %w", err)
+	}
+
+	return los, nil
+}
+
+// CopyLargeObject copies the content, the owner and the ACL of the large object with the same OID.
+// If overwrite is true, the existing large object in dst will be replaced.
+func CopyLargeObject(ctx context.Context, src, dst *Conn, lo LargeObject, overwrite bool) (int64, error) {
+	aclQueries, err := LargeObjectACLQueries(lo)
+	if err != nil {
+		return 0, err
+	}
+
+	stx, err := src.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return 0, fmt.Errorf("beginning a new transaction in the source: %w", err)
+	}
+
+	defer stx.Rollback(ctx)
+
+	dtx, err := dst.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("beginning a new transaction in the destination: %w", err)
+	}
+
+	defer dtx.Rollback(ctx)
+
+	slos := stx.LargeObjects()
+
+	sobj, err := slos.Open(ctx, lo.OID, pgx.LargeObjectModeRead)
+	if err != nil {
+		return 0, fmt.Errorf("opening the large object %d in the source: %w", lo.OID, err)
+	}
+
+	dlos := dtx.LargeObjects()
+
+	if overwrite {
+		if _, err := dtx.Exec(
+			ctx,
+			`SELECT lo_unlink(oid) FROM pg_largeobject_metadata WHERE oid = $1::bigint::oid;`,
+			int64(lo.OID),
+		); err != nil {
+			return 0, fmt.Errorf("unlinking the large object %d in the destination: %w", lo.OID, err)
+		}
+	}
+
+	if _, err := dlos.Create(ctx, lo.OID); err != nil {
+		return 0, fmt.Errorf("creating the large object %d in the destination: %w", lo.OID, err)
+	}
+
+	dobj, err := dlos.Open(ctx, lo.OID, pgx.LargeObjectModeWrite)
+	if err != nil {
+		return 0, fmt.Errorf("opening the large object %d in the destination: %w", lo.OID, err)
+	}
+
+	n, err := io.CopyBuffer(dobj, sobj, make([]byte, copyBufferSize))
+	if err != nil {
+		return n, fmt.Errorf("copying the large object %d: %w", lo.OID, err)
+	}
+
+	if err := dobj.Close(); err != nil {
+		return n, fmt.Errorf("closing the large object %d in the destination: %w", lo.OID, err)
+	}
+
+	for _, q := range aclQueries {
+		if _, err := dtx.Exec(ctx, q); err != nil {
+			return n, fmt.Errorf("setting the privileges of the large object %d: %w", lo.OID, err)
+		}
+	}
+
+	if err := dtx.Commit(ctx); err != nil {
+		return n, fmt.Errorf("commiting the large object %d: %w", lo.OID, err)
+	}
+
+	return n, nil
+}
+
+// LargeObjectACLQueries returns the queries to restore the owner and the privileges of the large object.
+func LargeObjectACLQueries(lo LargeObject) ([]string, error) {
+	queries := []string{
+		fmt.Sprintf(`ALTER LARGE OBJECT %d OWNER TO %s;`, lo.OID, quoteIdentifier(lo.Owner)),
+	}
+
+	for _, item := range lo.ACL {
+		grantee, privs, err := parseACLItem(item)
+		if err != nil {
+			return nil, err
+		}
+
+		// the owner has all the privileges implicitly
+		if grantee == lo.Owner {
+			continue
+		}
+
+		to := "PUBLIC"
+		if grantee != "" {
+			to = quoteIdentifier(grantee)
+		}
+
+		for i := 0; i < len(privs); i++ {
+			var priv string
+			switch privs[i] {
+			case 'r':
+				priv = "SELECT"
+			case 'w':
+				priv = "UPDATE"
+			default:
+				return nil, fmt.Errorf("unknown privilege '%c' for the large object in '%s'", privs[i], item)
+			}
+
+			withGrantOption := ""
+			if i+1 < len(privs) && privs[i+1] == '*' {
+				withGrantOption = " WITH GRANT OPTION"
+				i++
+			}
+
+			queries = append(queries, fmt.Sprintf(
+				`GRANT %s ON LARGE OBJECT %d TO %s%s;`,
+				priv, lo.OID, to, withGrantOption,
+			))
+		}
+	}
+
+	return queries, nil
+}
+
+// parseACLItem parses aclitem in the text form into the grantee and the privileges.
+// The grantee is empty for PUBLIC.
+func parseACLItem(item string) (string, string, error) {
+	var grantee strings.Builder
+
+	i := 0
+	if strings.HasPrefix(item, `"`) {
+		i = 1
+		for {
+			if i >= len(item) {
+				return "", "", fmt.Errorf("unterminated quoted grantee in '%s'", item)
+			}
+
+			if item[i] == '"' {
+				if i+1 < len(item) && item[i+1] == '"' {
+					grantee.WriteByte('"')
+					i += 2
+					continue
+				}
+				i++
+				break
+			}
+
+			grantee.WriteByte(item[i])
+			i++
+		}
+	} else {
+		for i < len(item) && item[i] != '=' {
+			grantee.WriteByte(item[i])
+			i++
+		}
+	}
+
+	if i >= len(item) || item[i] != '=' {
+		return "", "", fmt.Errorf("malformed aclitem '%s'", item)
+	}
+
+	privs, _, _ := strings.Cut(item[i+1:], "/")
+
+	return grantee.String(), privs, nil
+}
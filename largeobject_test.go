@@ -0,0 +1,39 @@
+package flare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLargeObjectACLQueries(t *testing.T) {
+	require := require.New(t)
+
+	actual, err := LargeObjectACLQueries(LargeObject{
+		OID:   16401,
+		Owner: "app",
+		ACL: []string{
+			"app=rw/app",
+			"=r/app",
+			`"read ""only"""=r*w/app`,
+		},
+	})
+	require.NoError(err)
+	require.Equal([]string{
+		`ALTER LARGE OBJECT 16401 OWNER TO "app";`,
+		`GRANT SELECT ON LARGE OBJECT 16401 TO PUBLIC;`,
+		`GRANT SELECT ON LARGE OBJECT 16401 TO "read ""only""" WITH GRANT OPTION;`,
+		`GRANT UPDATE ON LARGE OBJECT 16401 TO "read ""only""";`,
+	}, actual)
+
+	actual, err = LargeObjectACLQueries(LargeObject{
+		OID:   16402,
+		Owner: "Foo",
+		ACL:   []string{`"Foo"=rw/"Foo"`},
+	})
+	require.NoError(err)
+	require.Equal([]string{`ALTER LARGE OBJECT 16402 OWNER TO "Foo";`}, actual)
+
+	_, err = LargeObjectACLQueries(LargeObject{OID: 1, Owner: "app", ACL: []string{"broken"}})
+	require.Error(err)
+}
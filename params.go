@@ -0,0 +1,200 @@
+package flare
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// forbiddenParams are the libpq parameters that can't be set in params.
+// They would connect to a different server or as a different user than the ones verified by flare,
+// or they have dedicated fields in the config.
+var forbiddenParams = map[string]string{
+	"host":        "host",
+	"hostaddr":    "host",
+	"port":        "port",
+	"dbname":      "the database name in the command",
+	"database":    "the database name in the command",
+	"user":        "the users in the config",
+	"password":    "the passwords in the config",
+	"passfile":    "the passwords in the config",
+	"service":     "service",
+	"servicefile": "PGSERVICEFILE",
+	"sslmode":     "tls",
+	"sslrootcert": "tls",
+	"sslcert":     "tls",
+	"sslkey":      "tls",
+}
+
+// unsupportedParams are the libpq parameters that pgx doesn't understand.
+// pgx sends the parameters other than its own ones to the server as run-time parameters
+// so the server would reject the connection from flare.
+var unsupportedParams = map[string]bool{
+	"channel_binding":           true,
+	"fallback_application_name": true,
+	"gssdelegation":             true,
+	"gssencmode":                true,
+	"gsslib":                    true,
+	"keepalives":                true,
+	"keepalives_count":          true,
+	"keepalives_idle":           true,
+	"keepalives_interval":       true,
+	"load_balance_hosts":        true,
+	"replication":               true,
+	"require_auth":              true,
+	"requirepeer":               true,
+	"ssl_max_protocol_version":  true,
+	"ssl_min_protocol_version":  true,
+	"sslcertmode":               true,
+	"sslcompression":            true,
+	"sslcrl":                    true,
+	"sslcrldir":                 true,
+	"sslsni":                    true,
+	"tcp_user_timeout":          true,
+}
+
+// ValidateParams validates the service and the libpq parameters.
+// The parameters are passed to both libpq (psql, pg_dump and the subscription) and pgx,
+// and pgx sends the ones it doesn't use to the server as run-time parameters
+// so only the parameters that both understand (e.g. application_name, options and connect_timeout) can be used.
+func (c ConnConfig) ValidateParams() error {
+	for _, k := range sortedKeys(c.Params) {
+		if use, ok := forbiddenParams[strings.ToLower(k)]; ok {
+			return fmt.Errorf("flare: '%s' in params for '%s' is not allowed (use %s instead)", k, c.Host, use)
+		}
+
+		if unsupportedParams[strings.ToLower(k)] {
+			return fmt.Errorf("flare: '%s' in params for '%s' is not supported by flare", k, c.Host)
+		}
+
+		if k == "" || strings.ContainsAny(k, " =") {
+			return fmt.Errorf("flare: invalid parameter name '%s' in params for '%s'", k, c.Host)
+		}
+	}
+
+	return nil
+}
+
+// connParams returns the libpq parameters for the connection from flare.
+func (hi HostInfo) connParams() url.Values {
+	v := url.Values{}
+
+	for k, p := range hi.Params {
+		v.Set(k, p)
+	}
+
+	if hi.Service != "" {
+		v.Set("service", hi.Service)
+	}
+
+	for _, p := range hi.TLS.params() {
+		v.Set(p[0], p[1])
+	}
+
+	return v
+}
+
+// subscriberParams returns the libpq parameters for the connection from the subscriber.
+// The service is not passed since pg_service.conf is read in the subscriber.
+func (hi HostInfo) subscriberParams() url.Values {
+	v := url.Values{}
+
+	for k, p := range hi.Params {
+		v.Set(k, p)
+	}
+
+	// the certificates are read in the subscriber so the paths can be different
+	for _, p := range hi.TLS.Merge(hi.TLSViaSubscriber).params() {
+		v.Set(p[0], p[1])
+	}
+
+	return v
+}
+
+// SubscriptionConnInfo returns the connection string for the subscription to connect to the publisher.
+// The password is omitted unless the subscription embeds it.
+func (ui UserInfo) SubscriptionConnInfo(dbName string, sub Subscription) (string, error) {
+	host := ui.hi.Host
+	if shost := ui.hi.HostViaSubscriber; shost != "" {
+		host = shost
+	}
+
+	port := ui.hi.Port
+	if sport := ui.hi.PortViaSubscriber; sport != "" {
+		port = sport
+	}
+
+	params := [][2]string{
+		{"host", host},
+		{"port", port},
+		{"dbname", dbName},
+		{"user", ui.User},
+	}
+
+	switch sub.PasswordMode {
+	case SubscriptionPasswordPassfile:
+		if sub.Passfile != "" {
+			params = append(params, [2]string{"passfile", sub.Passfile})
+		}
+	case SubscriptionPasswordNone:
+	case "", SubscriptionPasswordEmbed:
+		params = append(params, [2]string{"password", ui.Password})
+	default:
+		return "", fmt.Errorf("flare: unknown password_mode '%s'", sub.PasswordMode)
+	}
+
+	v := ui.hi.subscriberParams()
+	for _, k := range sortedKeys(v) {
+		params = append(params, [2]string{k, v.Get(k)})
+	}
+
+	return buildConnInfo(params), nil
+}
+
+// buildURI returns the connection URI. The Unix-domain socket directory is passed as the host parameter.
+func buildURI(up *url.Userinfo, host, port, dbName string, v url.Values) string {
+	if strings.HasPrefix(host, "/") {
+		v.Set("host", host)
+		host = ""
+	}
+
+	uri := fmt.Sprintf("postgres://%s@%s:%s/%s", up.String(), host, port, dbName)
+
+	if len(v) == 0 {
+		return uri
+	}
+
+	// libpq doesn't decode '+' into a space
+	return uri + "?" + strings.ReplaceAll(v.Encode(), "+", "%20")
+}
+
+// buildConnInfo returns the connection string in the keyword/value format for psql and pg_dump.
+func buildConnInfo(params [][2]string) string {
+	var kvs []string
+
+	for _, p := range params {
+		kvs = append(kvs, p[0]+"="+quoteConnInfoValue(p[1]))
+	}
+
+	return strings.Join(kvs, " ")
+}
+
+func quoteConnInfoValue(s string) string {
+	return `'` + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + `'`
+}
+
+// passthroughEnv is the environment variables passed to psql, pg_dump and pg_dumpall to read pg_service.conf.
+var passthroughEnv = []string{"HOME", "PGSERVICEFILE", "PGSYSCONFDIR"}
+
+func lookupEnv(names []string) []string {
+	var env []string
+
+	for _, name := range names {
+		if v, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+v)
+		}
+	}
+
+	return env
+}
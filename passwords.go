@@ -0,0 +1,260 @@
+package flare
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/goccy/go-yaml"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	scramSHA256Iterations = 4096
+	scramSHA256SaltLen    = 16
+)
+
+// PasswordSource returns the password for a given role.
+type PasswordSource interface {
+	Password(ctx context.Context, role string) (string, error)
+}
+
+// FilePasswordSource reads the passwords from a YAML file mapping the role names to the passwords.
+type FilePasswordSource struct {
+	Passwords map[string]string
+}
+
+func ReadPasswordFile(fn string) (FilePasswordSource, error) {
+	b, err := os.ReadFile(fn)
+	if err != nil {
+		return FilePasswordSource{}, fmt.Errorf("reading the password file: %w", err)
+	}
+
+	src := FilePasswordSource{}
+	if err := yaml.Unmarshal(b, &src.Passwords); err != nil {
+		return src, fmt.Errorf("parsing the password file: %w", err)
+	}
+
+	return src, nil
+}
+
+func (s FilePasswordSource) Password(_ context.Context, role string) (string, error) {
+	pass, ok := s.Passwords[role]
+	if !ok {
+		return "", fmt.Errorf("flare: no password for '%s' in the file", role)
+	}
+
+	return pass, nil
+}
+
+// Roles returns the roles in the file.
+func (s FilePasswordSource) Roles() []string {
+	return sortedKeys(s.Passwords)
+}
+
+// EnvPasswordSource reads the password from the environment variable named Prefix + the upper-cased role name
+// where the characters other than letters and digits are replaced with '_' (e.g. FLARE_PASSWORD_APP_USER for app-user).
+type EnvPasswordSource struct {
+	Prefix string
+}
+
+func (s EnvPasswordSource) Password(_ context.Context, role string) (string, error) {
+	name := s.EnvName(role)
+
+	pass, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("flare: no password for '%s' in %s", role, name)
+	}
+
+	return pass, nil
+}
+
+func (s EnvPasswordSource) EnvName(role string) string {
+	return s.Prefix + strings.Map(func(r rune) rune {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			return unicode.ToUpper(r)
+		}
+		return '_'
+	}, role)
+}
+
+// ExecPasswordSource runs the command with `sh -c` for each role.
+// The role name is passed as $1 and FLARE_ROLE. The trailing newline in the output is removed.
+type ExecPasswordSource struct {
+	Command string
+}
+
+func (s ExecPasswordSource) Password(ctx context.Context, role string) (string, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", s.Command, "flare", role)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("FLARE_ROLE=%s", role))
+
+	var out bytes.Buffer
+	var errout bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errout
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running the password command for '%s': %w: %s", role, err, errout.String())
+	}
+
+	pass := strings.TrimRight(out.String(), "\r\n")
+	if pass == "" {
+		return "", fmt.Errorf("flare: the password command returned an empty password for '%s'", role)
+	}
+
+	return pass, nil
+}
+
+// NewSCRAMSHA256Verifier returns a SCRAM-SHA-256 verifier for the password with a random salt.
+func NewSCRAMSHA256Verifier(password string) (string, error) {
+	salt := make([]byte, scramSHA256SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("generating the salt: %w", err)
+	}
+
+	return SCRAMSHA256Verifier(password, salt, scramSHA256Iterations)
+}
+
+// ErrNonASCIIPassword is returned for the passwords that PostgreSQL normalizes with SASLprep before hashing.
+var ErrNonASCIIPassword = errors.New("flare: the password contains non-ASCII characters that PostgreSQL normalizes with SASLprep; set it with ALTER ROLE ... PASSWORD in the subscriber instead")
+
+// SCRAMSHA256Verifier returns the verifier in the format stored in pg_authid.rolpassword.
+// PostgreSQL uses the ASCII passwords as they are, so the other passwords are rejected with ErrNonASCIIPassword.
+func SCRAMSHA256Verifier(password string, salt []byte, iterations int) (string, error) {
+	for i := 0; i < len(password); i++ {
+		if password[i] >= utf8.RuneSelf {
+			return "", ErrNonASCIIPassword
+		}
+	}
+
+	saltedPassword := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+
+	clientKey := hmacSHA256(saltedPassword, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	serverKey := hmacSHA256(saltedPassword, "Server Key")
+
+	enc := base64.StdEncoding
+
+	return fmt.Sprintf(
+		"SCRAM-SHA-256$%d:%s$%s:%s",
+		iterations,
+		enc.EncodeToString(salt),
+		enc.EncodeToString(storedKey[:]),
+		enc.EncodeToString(serverKey),
+	), nil
+}
+
+func hmacSHA256(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
+
+// SetPasswordQuery sets the pre-hashed password so the plaintext never reaches the server nor its logs.
+func SetPasswordQuery(role, verifier string) string {
+	return fmt.Sprintf(`ALTER ROLE %s PASSWORD %s;`, quoteIdentifier(role), quoteLiteral(verifier))
+}
+
+// VerifyLogin makes sure that the role can log in to the database with the password.
+func VerifyLogin(ctx context.Context, ui UserInfo, dbName string) error {
+	conn, err := Connect(ctx, ui, dbName)
+	if err != nil {
+		return fmt.Errorf("logging in as '%s': %w", ui.User, err)
+	}
+
+	defer conn.Close(ctx)
+
+	if err := conn.Ping(ctx); err != nil {
+		return fmt.Errorf("pinging as '%s': %w", ui.User, err)
+	}
+
+	return nil
+}
+
+// PasswordVerifier is the hashed password in pg_authid.rolpassword.
+type PasswordVerifier struct {
+	Role     string
+	Verifier string
+}
+
+func (v PasswordVerifier) IsMD5() bool {
+	return strings.HasPrefix(v.Verifier, "md5") && len(v.Verifier) == 35
+}
+
+func (v PasswordVerifier) IsSCRAMSHA256() bool {
+	return strings.HasPrefix(v.Verifier, "SCRAM-SHA-256$")
+}
+
+// ListPasswordVerifiers reads the verifiers from pg_authid. It requires the superuser
+// so it fails on managed services such as RDS.
+func ListPasswordVerifiers(ctx context.Context, conn *Conn) ([]PasswordVerifier, error) {
+	rows, err := conn.Query(
+		ctx,
+		`SELECT rolname, rolpassword FROM pg_authid WHERE rolname !~ '^pg_' AND rolpassword IS NOT NULL ORDER BY rolname;`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("querying pg_authid: %w", err)
+	}
+
+	defer rows.Close()
+
+	var ret []PasswordVerifier
+
+	for rows.Next() {
+		var v PasswordVerifier
+		if err := rows.Scan(&v.Role, &v.Verifier); err != nil {
+			return nil, fmt.Errorf("scanning pg_authid: %w", err)
+		}
+
+		ret = append(ret, v)
+	}
+
+	return ret, rows.Err()
+}
+
+// FilterPasswordVerifiers returns the verifiers only for the roles.
+func FilterPasswordVerifiers(verifiers []PasswordVerifier, roles []Role) []PasswordVerifier {
+	names := map[string]bool{}
+	for _, r := range roles {
+		names[r.Name] = true
+	}
+
+	var ret []PasswordVerifier
+	for _, v := range verifiers {
+		if names[v.Role] {
+			ret = append(ret, v)
+		}
+	}
+
+	return ret
+}
+
+// PasswordVerifiersSQL sets the verifiers as-is. PostgreSQL stores a pre-hashed password without hashing it again.
+func PasswordVerifiersSQL(verifiers []PasswordVerifier) string {
+	var b strings.Builder
+
+	for _, v := range verifiers {
+		fmt.Fprintln(&b, SetPasswordQuery(v.Role, v.Verifier))
+	}
+
+	return b.String()
+}
+
+func GetPasswordEncryption(ctx context.Context, conn *Conn) (string, error) {
+	var enc string
+	if err := conn.QueryRow(ctx, `SHOW password_encryption;`).Scan(&enc); err != nil {
+		return "", fmt.Errorf("querying password_encryption: %w", err)
+	}
+
+	return enc, nil
+}
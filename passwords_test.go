@@ -0,0 +1,77 @@
+package flare
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSCRAMSHA256Verifier(t *testing.T) {
+	require := require.New(t)
+
+	salt := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+	verifier, err := SCRAMSHA256Verifier("pencil", salt, 4096)
+	require.NoError(err)
+	require.Equal(
+		"SCRAM-SHA-256$4096:AAECAwQFBgcICQoLDA0ODw==$zHCdol2044/ZyWzPLi7oxApCkamKw9Z+E4U/QApd/5Y=:dd5peBOitVnLNFu7VmwP+HiDaaw4OUCv396eVCWhYiE=",
+		verifier,
+	)
+
+	_, err = SCRAMSHA256Verifier("pässword", salt, 4096)
+	require.ErrorIs(err, ErrNonASCIIPassword)
+
+	require.Equal(
+		`ALTER ROLE "app" PASSWORD 'SCRAM-SHA-256$4096:salt$stored:server';`,
+		SetPasswordQuery("app", "SCRAM-SHA-256$4096:salt$stored:server"),
+	)
+}
+
+func TestPasswordSources(t *testing.T) {
+	require := require.New(t)
+	ctx := context.Background()
+
+	t.Run("Env", func(t *testing.T) {
+		src := EnvPasswordSource{Prefix: "FLARE_PASSWORD_"}
+		require.Equal("FLARE_PASSWORD_APP_USER", src.EnvName("app-user"))
+
+		t.Setenv("FLARE_PASSWORD_APP_USER", "secret")
+
+		pass, err := src.Password(ctx, "app-user")
+		require.NoError(err)
+		require.Equal("secret", pass)
+
+		_, err = src.Password(ctx, "unknown")
+		require.Error(err)
+	})
+
+	t.Run("Exec", func(t *testing.T) {
+		src := ExecPasswordSource{Command: `echo "pass-$1-$FLARE_ROLE"`}
+
+		pass, err := src.Password(ctx, "app")
+		require.NoError(err)
+		require.Equal("pass-app-app", pass)
+	})
+}
+
+func TestPasswordVerifiers(t *testing.T) {
+	require := require.New(t)
+
+	verifiers := []PasswordVerifier{
+		{Role: "app", Verifier: "md5a8b1d7a0b3c9e5d7f6b2e3c4d5a6b7c8"},
+		{Role: "dbowner", Verifier: "SCRAM-SHA-256$4096:salt$stored:server"},
+		{Role: "rdsadmin", Verifier: "md500000000000000000000000000000000"},
+	}
+
+	require.True(verifiers[0].IsMD5())
+	require.False(verifiers[0].IsSCRAMSHA256())
+	require.True(verifiers[1].IsSCRAMSHA256())
+	require.False(verifiers[1].IsMD5())
+
+	actual := FilterPasswordVerifiers(verifiers, []Role{{Name: "app"}, {Name: "dbowner"}})
+
+	require.Equal(`ALTER ROLE "app" PASSWORD 'md5a8b1d7a0b3c9e5d7f6b2e3c4d5a6b7c8';
+ALTER ROLE "dbowner" PASSWORD 'SCRAM-SHA-256$4096:salt$stored:server';
+`, PasswordVerifiersSQL(actual))
+}
@@ -0,0 +1,206 @@
+package flare
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// ObjectPrivileges holds the effective privileges of a role on an object.
+type ObjectPrivileges struct {
+	// Kind is one of database, schema, table, sequence and function.
+	Kind string
+
+	// Name is the quoted and schema-qualified name. Functions have the argument types (e.g. public.f(integer)).
+	Name string
+
+	Privileges []string
+}
+
+func (p ObjectPrivileges) key() string {
+	return p.Kind + " " + p.Name
+}
+
+// the privileges are checked with has_*_privilege so that the memberships and PUBLIC are taken into account
+const listEffectivePrivilegesQuery = `
+WITH
+  user_namespaces AS (
+    SELECT oid, nspname
+    FROM pg_namespace
+    WHERE nspname !~ '^pg_' AND nspname <> 'information_schema'
+  ),
+  privs AS (
+    SELECT 'database' AS kind, quote_ident(current_database()) AS name, p.priv
+    FROM unnest(ARRAY['CONNECT', 'CREATE', 'TEMPORARY']) AS p(priv)
+    WHERE has_database_privilege($1, current_database(), p.priv)
+
+    UNION ALL
+
+    SELECT 'schema', quote_ident(n.nspname), p.priv
+    FROM user_namespaces n
+    CROSS JOIN unnest(ARRAY['USAGE', 'CREATE']) AS p(priv)
+    WHERE has_schema_privilege($1, n.oid, p.priv)
+
+    UNION ALL
+
+    SELECT 'table', quote_ident(n.nspname) || '.' || quote_ident(c.relname), p.priv
+    FROM pg_class c
+    JOIN user_namespaces n ON n.oid = c.relnamespace
+    CROSS JOIN unnest(ARRAY['SELECT', 'INSERT', 'UPDATE', 'DELETE', 'TRUNCATE', 'REFERENCES', 'TRIGGER']) AS p(priv)
+    WHERE c.relkind IN ('r', 'p', 'v', 'm', 'f') AND has_table_privilege($1, c.oid, p.priv)
+
+    UNION ALL
+
+    SELECT 'sequence', quote_ident(n.nspname) || '.' || quote_ident(c.relname), p.priv
+    FROM pg_class c
+    JOIN user_namespaces n ON n.oid = c.relnamespace
+    CROSS JOIN unnest(ARRAY['USAGE', 'SELECT', 'UPDATE']) AS p(priv)
+    WHERE c.relkind = 'S' AND has_sequence_privilege($1, c.oid, p.priv)
+
+    UNION ALL
+
+    SELECT
+      'function',
+      quote_ident(n.nspname) || '.' || quote_ident(f.proname) || '(' || pg_get_function_identity_arguments(f.oid) || ')',
+      'EXECUTE'
+    FROM pg_proc f
+    JOIN user_namespaces n ON n.oid = f.pronamespace
+    WHERE has_function_privilege($1, f.oid, 'EXECUTE')
+  )
+SELECT kind, name, array_agg(priv ORDER BY priv)
+FROM privs
+GROUP BY kind, name
+ORDER BY kind, name;
+`
+
+// ListEffectivePrivileges returns the effective privileges of the role on the objects in the current database.
+// The objects without any privileges are not returned.
+func ListEffectivePrivileges(ctx context.Context, conn *Conn, role string) ([]ObjectPrivileges, error) {
+	rows, err := conn.Query(ctx, listEffectivePrivilegesQuery, role)
+	if err != nil {
+		return nil, fmt.Errorf("querying the privileges of '%s': %w", role, err)
+	}
+
+	defer rows.Close()
+
+	var ret []ObjectPrivileges
+
+	for rows.Next() {
+		var p ObjectPrivileges
+		if err := rows.Scan(&p.Kind, &p.Name, &p.Privileges); err != nil {
+			return nil, fmt.Errorf("scanning the privileges of '%s': %w", role, err)
+		}
+
+		ret = append(ret, p)
+	}
+
+	return ret, rows.Err()
+}
+
+// RoleExists returns true if the role exists.
+func RoleExists(ctx context.Context, conn *Conn, role string) (bool, error) {
+	var exists bool
+	if err := conn.QueryRow(
+		ctx,
+		`SELECT EXISTS (SELECT FROM pg_roles WHERE rolname = $1);`,
+		role,
+	).Scan(&exists); err != nil {
+		return false, fmt.Errorf("querying the role '%s': %w", role, err)
+	}
+
+	return exists, nil
+}
+
+type PrivilegeDiff struct {
+	Action ChangeAction
+	Role   string
+	Kind   string
+	Name   string
+	Detail string
+}
+
+func (d PrivilegeDiff) String() string {
+	return fmt.Sprintf("%s %q on %s %s: %s", d.Action.Symbol(), d.Role, d.Kind, d.Name, d.Detail)
+}
+
+// DiffPrivileges compares the effective privileges of the role in the publisher (src) with the subscriber (dst).
+// ChangeActionCreate means the privilege is missing in the subscriber and ChangeActionDelete means it exists only in the subscriber.
+func DiffPrivileges(role string, src, dst []ObjectPrivileges) []PrivilegeDiff {
+	dstByKey := map[string]ObjectPrivileges{}
+	for _, p := range dst {
+		dstByKey[p.key()] = p
+	}
+
+	srcByKey := map[string]ObjectPrivileges{}
+
+	var diffs []PrivilegeDiff
+
+	for _, sp := range src {
+		srcByKey[sp.key()] = sp
+
+		dp, ok := dstByKey[sp.key()]
+		if !ok {
+			diffs = append(diffs, PrivilegeDiff{
+				Action: ChangeActionCreate,
+				Role:   role,
+				Kind:   sp.Kind,
+				Name:   sp.Name,
+				Detail: "missing " + strings.Join(sp.Privileges, ", "),
+			})
+			continue
+		}
+
+		if missing := subtractStrings(sp.Privileges, dp.Privileges); len(missing) > 0 {
+			diffs = append(diffs, PrivilegeDiff{
+				Action: ChangeActionCreate,
+				Role:   role,
+				Kind:   sp.Kind,
+				Name:   sp.Name,
+				Detail: "missing " + strings.Join(missing, ", "),
+			})
+		}
+
+		if extra := subtractStrings(dp.Privileges, sp.Privileges); len(extra) > 0 {
+			diffs = append(diffs, PrivilegeDiff{
+				Action: ChangeActionDelete,
+				Role:   role,
+				Kind:   sp.Kind,
+				Name:   sp.Name,
+				Detail: "only in the subscriber: " + strings.Join(extra, ", "),
+			})
+		}
+	}
+
+	for _, dp := range dst {
+		if _, ok := srcByKey[dp.key()]; ok {
+			continue
+		}
+
+		diffs = append(diffs, PrivilegeDiff{
+			Action: ChangeActionDelete,
+			Role:   role,
+			Kind:   dp.Kind,
+			Name:   dp.Name,
+			Detail: "only in the subscriber: " + strings.Join(dp.Privileges, ", "),
+		})
+	}
+
+	return diffs
+}
+
+// subtractStrings returns the elements in a that are not in b.
+func subtractStrings(a, b []string) []string {
+	inB := map[string]bool{}
+	for _, s := range b {
+		inB[s] = true
+	}
+
+	var ret []string
+	for _, s := range a {
+		if !inB[s] {
+			ret = append(ret, s)
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,34 @@
+package flare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffPrivileges(t *testing.T) {
+	require := require.New(t)
+
+	src := []ObjectPrivileges{
+		{Kind: "schema", Name: "sales", Privileges: []string{"USAGE"}},
+		{Kind: "sequence", Name: "sales.orders_id_seq", Privileges: []string{"SELECT", "USAGE"}},
+		{Kind: "table", Name: "sales.orders", Privileges: []string{"INSERT", "SELECT", "UPDATE"}},
+	}
+
+	dst := []ObjectPrivileges{
+		{Kind: "function", Name: "sales.f(integer)", Privileges: []string{"EXECUTE"}},
+		{Kind: "schema", Name: "sales", Privileges: []string{"USAGE"}},
+		{Kind: "table", Name: "sales.orders", Privileges: []string{"DELETE", "SELECT"}},
+	}
+
+	diffs := DiffPrivileges("app", src, dst)
+
+	require.Equal([]PrivilegeDiff{
+		{Action: ChangeActionCreate, Role: "app", Kind: "sequence", Name: "sales.orders_id_seq", Detail: "missing SELECT, USAGE"},
+		{Action: ChangeActionCreate, Role: "app", Kind: "table", Name: "sales.orders", Detail: "missing INSERT, UPDATE"},
+		{Action: ChangeActionDelete, Role: "app", Kind: "table", Name: "sales.orders", Detail: "only in the subscriber: DELETE"},
+		{Action: ChangeActionDelete, Role: "app", Kind: "function", Name: "sales.f(integer)", Detail: "only in the subscriber: EXECUTE"},
+	}, diffs)
+
+	require.Equal(`+ "app" on table sales.orders: missing INSERT, UPDATE`, diffs[1].String())
+}
@@ -0,0 +1,253 @@
+package flare
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ProviderProfile describes what a managed service doesn't allow and how flare works around it.
+type ProviderProfile struct {
+	// SkipRoles holds the patterns of the roles managed by the provider. They are never created nor altered.
+	SkipRoles []string `yaml:"skip_roles"`
+
+	// StripAttributes holds the role attributes that can't be set (e.g. SUPERUSER).
+	StripAttributes []string `yaml:"strip_attributes"`
+
+	// AttributeGrants maps a stripped attribute to the role granted instead (e.g. SUPERUSER to rds_superuser).
+	AttributeGrants map[string]string `yaml:"attribute_grants"`
+
+	// DisallowedSettings holds the patterns of the settings that can't be set by ALTER ROLE ... SET.
+	DisallowedSettings []string `yaml:"disallowed_settings"`
+
+	// DisallowedExtensions holds the patterns of the extensions that can't be installed.
+	DisallowedExtensions []string `yaml:"disallowed_extensions"`
+}
+
+var rdsProfile = ProviderProfile{
+	SkipRoles:       []string{"rdsadmin", "rdsrepladmin", "rdstopmgr", "rds_*"},
+	StripAttributes: []string{"SUPERUSER", "REPLICATION", "BYPASSRLS"},
+	AttributeGrants: map[string]string{
+		"SUPERUSER":   "rds_superuser",
+		"REPLICATION": "rds_replication",
+	},
+	DisallowedSettings:   []string{"session_preload_libraries", "local_preload_libraries"},
+	DisallowedExtensions: []string{"adminpack", "file_fdw", "plpythonu", "plpython3u", "plperlu"},
+}
+
+// BuiltinProviderProfiles are selected by `provider` in the host config.
+var BuiltinProviderProfiles = map[string]ProviderProfile{
+	"rds":    rdsProfile,
+	"aurora": rdsProfile,
+	"cloudsql": {
+		SkipRoles:       []string{"cloudsqladmin", "cloudsqlagent", "cloudsqlsuperuser", "cloudsqlimportexport", "cloudsqlreplica", "cloudsqliamuser", "cloudsqliamserviceaccount"},
+		StripAttributes: []string{"SUPERUSER", "BYPASSRLS"},
+		AttributeGrants: map[string]string{
+			"SUPERUSER": "cloudsqlsuperuser",
+		},
+		DisallowedSettings:   []string{"session_preload_libraries", "local_preload_libraries"},
+		DisallowedExtensions: []string{"adminpack", "file_fdw", "plpythonu", "plpython3u", "plperlu"},
+	},
+	"azure": {
+		SkipRoles:       []string{"azuresu", "azure_superuser", "azure_pg_admin", "azure_*", "replication"},
+		StripAttributes: []string{"SUPERUSER", "BYPASSRLS"},
+		AttributeGrants: map[string]string{
+			"SUPERUSER": "azure_pg_admin",
+		},
+		DisallowedSettings:   []string{"session_preload_libraries", "local_preload_libraries"},
+		DisallowedExtensions: []string{"adminpack", "file_fdw", "plpythonu", "plpython3u", "plperlu"},
+	},
+}
+
+// ProviderProfile returns the profile for the host. The profiles in the config take precedence over the built-in ones.
+// The empty profile is returned for a self-managed host.
+func (c Config) ProviderProfile(h Host) (ProviderProfile, error) {
+	if h.Provider == "" {
+		return ProviderProfile{}, nil
+	}
+
+	if p, ok := c.Providers[h.Provider]; ok {
+		return p, nil
+	}
+
+	if p, ok := BuiltinProviderProfiles[h.Provider]; ok {
+		return p, nil
+	}
+
+	return ProviderProfile{}, fmt.Errorf("flare: unknown provider '%s'", h.Provider)
+}
+
+func (p ProviderProfile) IsSkippedRole(name string) bool {
+	skipped, _ := matchAny(p.SkipRoles, name)
+	return skipped
+}
+
+func (p ProviderProfile) IsDisallowedExtension(name string) bool {
+	disallowed, _ := matchAny(p.DisallowedExtensions, name)
+	return disallowed
+}
+
+func (p ProviderProfile) IsDisallowedSetting(name string) bool {
+	disallowed, _ := matchAny(p.DisallowedSettings, name)
+	return disallowed
+}
+
+func (p ProviderProfile) grantRoles() map[string]bool {
+	ret := map[string]bool{}
+	for _, r := range p.AttributeGrants {
+		ret[r] = true
+	}
+
+	return ret
+}
+
+// ApplyProviderProfiles adjusts the roles in the publisher (src) to be created in the subscriber (dst).
+// The roles managed by either provider are removed, the memberships in them are kept only when dst grants them,
+// the stripped attributes are replaced with the grants in dst and the disallowed settings are removed.
+func ApplyProviderProfiles(roles []Role, src, dst ProviderProfile) ([]Role, RoleSQLOptions) {
+	dstGrantRoles := dst.grantRoles()
+
+	skipped := func(name string) bool {
+		return src.IsSkippedRole(name) || dst.IsSkippedRole(name)
+	}
+
+	var ret []Role
+
+	for _, r := range roles {
+		if skipped(r.Name) {
+			continue
+		}
+
+		var memberOf []RoleMembership
+		for _, ms := range r.MemberOf {
+			if skipped(ms.Role) && !dstGrantRoles[ms.Role] {
+				continue
+			}
+
+			memberOf = append(memberOf, ms)
+		}
+
+		for _, attr := range sortedKeys(dst.AttributeGrants) {
+			if !r.hasAttribute(attr) {
+				continue
+			}
+
+			ms := RoleMembership{Role: dst.AttributeGrants[attr]}
+			if !containsMembership(memberOf, ms) {
+				memberOf = append(memberOf, ms)
+			}
+		}
+
+		sort.SliceStable(memberOf, func(i, j int) bool { return memberOf[i].Role < memberOf[j].Role })
+
+		var settings []RoleSetting
+		for _, st := range r.Settings {
+			if dst.IsDisallowedSetting(st.Name) {
+				continue
+			}
+
+			settings = append(settings, st)
+		}
+
+		r.MemberOf = memberOf
+		r.Settings = settings
+
+		ret = append(ret, r)
+	}
+
+	return ret, RoleSQLOptions{SkipAttributes: dst.StripAttributes}
+}
+
+func (r Role) hasAttribute(attr string) bool {
+	switch strings.ToUpper(attr) {
+	case "SUPERUSER":
+		return r.SuperUser
+	case "CREATEROLE":
+		return r.CreateRole
+	case "CREATEDB":
+		return r.CreateDB
+	case "REPLICATION":
+		return r.Replication
+	case "BYPASSRLS":
+		return r.BypassRLS
+	}
+
+	return false
+}
+
+// FilterSchemaForProvider comments out the statements in the output of pg_dump that reference
+// the roles managed by either provider or the extensions that dst doesn't allow.
+func FilterSchemaForProvider(schema string, src, dst ProviderProfile) (string, error) {
+	skippedRole := func(name string) bool {
+		return src.IsSkippedRole(name) || dst.IsSkippedRole(name)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(schema))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	var b strings.Builder
+
+	for scanner.Scan() {
+		t := scanner.Text()
+
+		if skip := schemaLineToSkip(t, skippedRole, dst.IsDisallowedExtension); skip {
+			fmt.Fprintf(&b, "-- flare: skipped for the provider: %s\n", t)
+			continue
+		}
+
+		fmt.Fprintf(&b, "%s\n", t)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("scanning the schema: %w", err)
+	}
+
+	return b.String(), nil
+}
+
+func schemaLineToSkip(t string, skippedRole, disallowedExt func(string) bool) bool {
+	switch {
+	case strings.HasPrefix(t, "ALTER ") && strings.Contains(t, " OWNER TO "):
+		_, role, _ := strings.Cut(t, " OWNER TO ")
+		return skippedRole(unquoteIdentifier(strings.TrimSuffix(role, ";")))
+
+	case strings.HasPrefix(t, "GRANT ") || strings.HasPrefix(t, "REVOKE "):
+		sep := " TO "
+		if strings.HasPrefix(t, "REVOKE ") {
+			sep = " FROM "
+		}
+
+		i := strings.LastIndex(t, sep)
+		if i < 0 {
+			return false
+		}
+
+		grantee := strings.TrimSuffix(t[i+len(sep):], ";")
+		grantee = strings.TrimSuffix(grantee, " WITH GRANT OPTION")
+
+		return skippedRole(unquoteIdentifier(grantee))
+
+	case strings.HasPrefix(t, "CREATE EXTENSION "):
+		name := strings.TrimPrefix(t, "CREATE EXTENSION ")
+		name = strings.TrimPrefix(name, "IF NOT EXISTS ")
+		name, _, _ = strings.Cut(name, " ")
+
+		return disallowedExt(unquoteIdentifier(strings.TrimSuffix(name, ";")))
+
+	case strings.HasPrefix(t, "COMMENT ON EXTENSION "):
+		name, _, _ := strings.Cut(strings.TrimPrefix(t, "COMMENT ON EXTENSION "), " ")
+
+		return disallowedExt(unquoteIdentifier(name))
+	}
+
+	return false
+}
+
+func unquoteIdentifier(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		return strings.ReplaceAll(s[1:len(s)-1], `""`, `"`)
+	}
+
+	return s
+}
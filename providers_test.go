@@ -0,0 +1,105 @@
+package flare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProviderProfile(t *testing.T) {
+	require := require.New(t)
+
+	cfg := Config{
+		Providers: map[string]ProviderProfile{
+			"custom": {SkipRoles: []string{"admin"}},
+		},
+	}
+
+	p, err := cfg.ProviderProfile(Host{})
+	require.NoError(err)
+	require.Equal(ProviderProfile{}, p)
+
+	p, err = cfg.ProviderProfile(Host{Provider: "custom"})
+	require.NoError(err)
+	require.True(p.IsSkippedRole("admin"))
+
+	p, err = cfg.ProviderProfile(Host{Provider: "rds"})
+	require.NoError(err)
+	require.True(p.IsSkippedRole("rds_superuser"))
+	require.True(p.IsDisallowedExtension("file_fdw"))
+
+	_, err = cfg.ProviderProfile(Host{Provider: "unknown"})
+	require.EqualError(err, "flare: unknown provider 'unknown'")
+}
+
+func TestApplyProviderProfiles(t *testing.T) {
+	require := require.New(t)
+
+	roles := []Role{
+		{Name: "rdsadmin", SuperUser: true},
+		{
+			Name:        "admin",
+			SuperUser:   true,
+			Replication: true,
+			MemberOf:    []RoleMembership{{Role: "rds_superuser"}, {Role: "readers"}},
+			Settings: []RoleSetting{
+				{Name: "session_preload_libraries", Value: "auto_explain"},
+				{Name: "statement_timeout", Value: "5s"},
+			},
+		},
+	}
+
+	t.Run("SelfManagedToRDS", func(t *testing.T) {
+		actual, opts := ApplyProviderProfiles(roles, ProviderProfile{}, BuiltinProviderProfiles["rds"])
+
+		require.Equal([]Role{
+			{
+				Name:        "admin",
+				SuperUser:   true,
+				Replication: true,
+				MemberOf: []RoleMembership{
+					{Role: "rds_replication"},
+					{Role: "rds_superuser"},
+					{Role: "readers"},
+				},
+				Settings: []RoleSetting{{Name: "statement_timeout", Value: "5s"}},
+			},
+		}, actual)
+		require.Equal([]string{"SUPERUSER", "REPLICATION", "BYPASSRLS"}, opts.SkipAttributes)
+	})
+
+	t.Run("RDSToSelfManaged", func(t *testing.T) {
+		actual, opts := ApplyProviderProfiles(roles, BuiltinProviderProfiles["rds"], ProviderProfile{})
+
+		require.Len(actual, 1)
+		require.Equal([]RoleMembership{{Role: "readers"}}, actual[0].MemberOf)
+		require.Empty(opts.SkipAttributes)
+	})
+}
+
+func TestFilterSchemaForProvider(t *testing.T) {
+	input := `CREATE EXTENSION IF NOT EXISTS file_fdw WITH SCHEMA public;
+COMMENT ON EXTENSION file_fdw IS 'foreign-data wrapper for flat file access';
+CREATE EXTENSION IF NOT EXISTS pgcrypto WITH SCHEMA public;
+ALTER TABLE public.items OWNER TO app;
+ALTER SCHEMA public OWNER TO rdsadmin;
+GRANT ALL ON SCHEMA public TO rds_superuser WITH GRANT OPTION;
+REVOKE ALL ON SCHEMA public FROM "rdsadmin";
+GRANT SELECT ON TABLE public.items TO readers;
+`
+	expected := `-- flare: skipped for the provider: CREATE EXTENSION IF NOT EXISTS file_fdw WITH SCHEMA public;
+-- flare: skipped for the provider: COMMENT ON EXTENSION file_fdw IS 'foreign-data wrapper for flat file access';
+CREATE EXTENSION IF NOT EXISTS pgcrypto WITH SCHEMA public;
+ALTER TABLE public.items OWNER TO app;
+-- flare: skipped for the provider: ALTER SCHEMA public OWNER TO rdsadmin;
+-- flare: skipped for the provider: GRANT ALL ON SCHEMA public TO rds_superuser WITH GRANT OPTION;
+-- flare: skipped for the provider: REVOKE ALL ON SCHEMA public FROM "rdsadmin";
+GRANT SELECT ON TABLE public.items TO readers;
+`
+
+	require := require.New(t)
+
+	actual, err := FilterSchemaForProvider(input, BuiltinProviderProfiles["rds"], BuiltinProviderProfiles["cloudsql"])
+	require.NoError(err)
+	require.Equal(expected, actual)
+}
@@ -0,0 +1,125 @@
+package flare
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QualifiedName is an optionally schema-qualified name of a table.
+// The table is looked up by search_path when Schema is empty.
+type QualifiedName struct {
+	Schema string
+	Name   string
+}
+
+// ParseQualifiedName parses `table`, `schema.table` or their double-quoted forms (e.g. `"my.schema"."Orders"`).
+// Unlike SQL, the unquoted parts are not folded to lower case so the names are taken as written.
+func ParseQualifiedName(s string) (QualifiedName, error) {
+	var parts []string
+	var b strings.Builder
+
+	quoted := false
+	closed := false
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+
+		switch {
+		case quoted && c == '"' && i+1 < len(s) && s[i+1] == '"':
+			b.WriteByte('"')
+			i++
+		case quoted && c == '"':
+			quoted = false
+			closed = true
+		case quoted:
+			b.WriteByte(c)
+		case c == '"' && b.Len() == 0 && !closed:
+			quoted = true
+		case c == '.':
+			parts = append(parts, b.String())
+			b.Reset()
+			closed = false
+		case closed:
+			return QualifiedName{}, fmt.Errorf("flare: unexpected '%c' after the quoted identifier in '%s'", c, s)
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	if quoted {
+		return QualifiedName{}, fmt.Errorf("flare: unterminated quoted identifier in '%s'", s)
+	}
+
+	parts = append(parts, b.String())
+
+	for _, p := range parts {
+		if p == "" {
+			return QualifiedName{}, fmt.Errorf("flare: invalid qualified name '%s'", s)
+		}
+	}
+
+	switch len(parts) {
+	case 1:
+		return QualifiedName{Name: parts[0]}, nil
+	case 2:
+		return QualifiedName{Schema: parts[0], Name: parts[1]}, nil
+	}
+
+	return QualifiedName{}, fmt.Errorf("flare: too many dots in the qualified name '%s'", s)
+}
+
+// MustParseQualifiedName is like ParseQualifiedName but panics if the name can't be parsed.
+func MustParseQualifiedName(s string) QualifiedName {
+	qn, err := ParseQualifiedName(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return qn
+}
+
+// Quote returns the name to be embedded in SQL.
+func (qn QualifiedName) Quote() string {
+	if qn.Schema == "" {
+		return quoteIdentifier(qn.Name)
+	}
+
+	return quoteIdentifier(qn.Schema) + "." + quoteIdentifier(qn.Name)
+}
+
+// String returns the name in the form parsed by ParseQualifiedName.
+// The parts are quoted only when they contain a dot or a double quote.
+func (qn QualifiedName) String() string {
+	quote := func(s string) string {
+		if strings.ContainsAny(s, `."`) {
+			return quoteIdentifier(s)
+		}
+		return s
+	}
+
+	if qn.Schema == "" {
+		return quote(qn.Name)
+	}
+
+	return quote(qn.Schema) + "." + quote(qn.Name)
+}
+
+func (qn *QualifiedName) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+
+	parsed, err := ParseQualifiedName(s)
+	if err != nil {
+		return err
+	}
+
+	*qn = parsed
+
+	return nil
+}
+
+func (qn QualifiedName) MarshalYAML() (interface{}, error) {
+	return qn.String(), nil
+}
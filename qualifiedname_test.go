@@ -0,0 +1,49 @@
+package flare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQualifiedName(t *testing.T) {
+	for _, tc := range []struct {
+		in       string
+		expected QualifiedName
+		quoted   string
+	}{
+		{in: "orders", expected: QualifiedName{Name: "orders"}, quoted: `"orders"`},
+		{in: "sales.orders", expected: QualifiedName{Schema: "sales", Name: "orders"}, quoted: `"sales"."orders"`},
+		{in: `"sales.orders"`, expected: QualifiedName{Name: "sales.orders"}, quoted: `"sales.orders"`},
+		{in: `"my schema"."Orders"`, expected: QualifiedName{Schema: "my schema", Name: "Orders"}, quoted: `"my schema"."Orders"`},
+		{in: `sales."a""b"`, expected: QualifiedName{Schema: "sales", Name: `a"b`}, quoted: `"sales"."a""b"`},
+	} {
+		t.Run(tc.in, func(t *testing.T) {
+			require := require.New(t)
+
+			actual, err := ParseQualifiedName(tc.in)
+			require.NoError(err)
+			require.Equal(tc.expected, actual)
+			require.Equal(tc.quoted, actual.Quote())
+
+			// String() round-trips
+			again, err := ParseQualifiedName(actual.String())
+			require.NoError(err)
+			require.Equal(actual, again)
+		})
+	}
+
+	for _, in := range []string{"", "a.b.c", ".orders", "sales.", `"sales`, `"sales"x.orders`} {
+		_, err := ParseQualifiedName(in)
+		require.Error(t, err, in)
+	}
+}
+
+func TestTableQueries(t *testing.T) {
+	require := require.New(t)
+
+	tbl := MustParseQualifiedName("sales.orders")
+
+	require.Equal(`ALTER TABLE "sales"."orders" REPLICA IDENTITY FULL;`, AlterTableReplicaIdentityFull(tbl))
+	require.Equal(`SELECT count(*) FROM "sales"."orders"`, CountRecordsInTablesQuery(tbl))
+}
@@ -0,0 +1,574 @@
+package flare
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type PublicationState struct {
+	Name      string
+	AllTables bool
+
+	Tables []QualifiedName
+}
+
+type PublisherDatabaseState struct {
+	DBName       string
+	Publications map[string]PublicationState
+
+	// ReplicaIdentityFull holds the configured tables that already have REPLICA IDENTITY FULL.
+	ReplicaIdentityFull map[QualifiedName]bool
+}
+
+type SubscriptionState struct {
+	Name         string
+	Enabled      bool
+	Publications []string
+
+	// Tables maps the tables to the state in pg_subscription_rel.
+	Tables map[QualifiedName]string
+}
+
+type SubscriberDatabaseState struct {
+	DBName        string
+	Subscriptions map[string]SubscriptionState
+}
+
+type State struct {
+	Publisher  map[string]PublisherDatabaseState
+	Subscriber map[string]SubscriberDatabaseState
+}
+
+func ListPublications(ctx context.Context, conn *Conn) ([]PublicationState, error) {
+	rows, err := conn.Query(ctx, `SELECT pubname, puballtables FROM pg_publication ORDER BY pubname;`)
+	if err != nil {
+		return nil, fmt.Errorf("querying the publications: %w", err)
+	}
+
+	var pubs []PublicationState
+
+	for rows.Next() {
+		var pub PublicationState
+		if err := rows.Scan(&pub.Name, &pub.AllTables); err != nil {
+			return nil, fmt.Errorf("scanning the publication: %w", err)
+		}
+
+		pubs = append(pubs, pub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("scanning the publications: %w", err)
+	}
+
+	for i := range pubs {
+		tables, err := ListPublicationTables(ctx, conn, pubs[i].Name)
+		if err != nil {
+			return nil, err
+		}
+
+		pubs[i].Tables = tables
+	}
+
+	return pubs, nil
+}
+
+func ListPublicationTables(ctx context.Context, conn *Conn, pubName string) ([]QualifiedName, error) {
+	rows, err := conn.Query(ctx, `
+SELECT schemaname, tablename
+FROM pg_publication_tables
+WHERE pubname = $1
+ORDER BY schemaname, tablename
+;
+	`, pubName)
+	if err != nil {
+		return nil, fmt.Errorf("querying the publication tables: %w", err)
+	}
+
+	var tables []QualifiedName
+
+	for rows.Next() {
+		var tbl QualifiedName
+		if err := rows.Scan(&tbl.Schema, &tbl.Name); err != nil {
+			return nil, fmt.Errorf("scanning the publication table: %w", err)
+		}
+
+		tables = append(tables, tbl)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("scanning the publication tables: %w", err)
+	}
+
+	return tables, nil
+}
+
+func ListSubscriptions(ctx context.Context, conn *Conn) ([]SubscriptionState, error) {
+	rows, err := conn.Query(ctx, `
+SELECT s.subname, s.subenabled, s.subpublications
+FROM pg_subscription s
+JOIN pg_database d ON d.oid = s.subdbid
+WHERE d.datname = current_database()
+ORDER BY s.subname
+;
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("querying the subscriptions: %w", err)
+	}
+
+	var subs []SubscriptionState
+
+	for rows.Next() {
+		var sub SubscriptionState
+		if err := rows.Scan(&sub.Name, &sub.Enabled, &sub.Publications); err != nil {
+			return nil, fmt.Errorf("scanning the subscription: %w", err)
+		}
+
+		subs = append(subs, sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("scanning the subscriptions: %w", err)
+	}
+
+	for i := range subs {
+		tables, err := ListSubscriptionRels(ctx, conn, subs[i].Name)
+		if err != nil {
+			return nil, err
+		}
+
+		subs[i].Tables = tables
+	}
+
+	return subs, nil
+}
+
+func ListSubscriptionRels(ctx context.Context, conn *Conn, subName string) (map[QualifiedName]string, error) {
+	rows, err := conn.Query(ctx, `
+SELECT n.nspname, c.relname, r.srsubstate::text
+FROM pg_subscription_rel r
+JOIN pg_subscription s ON s.oid = r.srsubid
+JOIN pg_class c ON c.oid = r.srrelid
+JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE s.subname = $1
+ORDER BY n.nspname, c.relname
+;
+	`, subName)
+	if err != nil {
+		return nil, fmt.Errorf("querying the subscription relations: %w", err)
+	}
+
+	tables := map[QualifiedName]string{}
+
+	for rows.Next() {
+		var (
+			tbl   QualifiedName
+			state string
+		)
+		if err := rows.Scan(&tbl.Schema, &tbl.Name, &state); err != nil {
+			return nil, fmt.Errorf("scanning the subscription relation: %w", err)
+		}
+
+		tables[tbl] = state
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("scanning the subscription relations: %w", err)
+	}
+
+	return tables, nil
+}
+
+func IsReplicaIdentityFull(ctx context.Context, conn *Conn, tbl QualifiedName) (bool, error) {
+	var full bool
+
+	if err := conn.QueryRow(
+		ctx,
+		`SELECT COALESCE((SELECT relreplident = 'f' FROM pg_class WHERE oid = to_regclass($1)), FALSE);`,
+		tbl.Quote(),
+	).Scan(&full); err != nil {
+		return false, fmt.Errorf("querying the replica identity of '%s': %w", tbl, err)
+	}
+
+	return full, nil
+}
+
+func ReadPublisherDatabaseState(ctx context.Context, conn *Conn, dbName string, pub Publication) (PublisherDatabaseState, error) {
+	st := PublisherDatabaseState{
+		DBName:              dbName,
+		Publications:        map[string]PublicationState{},
+		ReplicaIdentityFull: map[QualifiedName]bool{},
+	}
+
+	pubs, err := ListPublications(ctx, conn)
+	if err != nil {
+		return st, err
+	}
+
+	for _, p := range pubs {
+		st.Publications[p.Name] = p
+	}
+
+	for _, tbl := range pub.ReplicaIdentityFullTables {
+		full, err := IsReplicaIdentityFull(ctx, conn, tbl)
+		if err != nil {
+			return st, err
+		}
+
+		st.ReplicaIdentityFull[tbl] = full
+	}
+
+	return st, nil
+}
+
+func ReadSubscriberDatabaseState(ctx context.Context, conn *Conn, dbName string) (SubscriberDatabaseState, error) {
+	st := SubscriberDatabaseState{
+		DBName:        dbName,
+		Subscriptions: map[string]SubscriptionState{},
+	}
+
+	subs, err := ListSubscriptions(ctx, conn)
+	if err != nil {
+		return st, err
+	}
+
+	for _, s := range subs {
+		st.Subscriptions[s.Name] = s
+	}
+
+	return st, nil
+}
+
+type ChangeAction string
+
+const (
+	ChangeActionCreate  ChangeAction = "create"
+	ChangeActionUpdate  ChangeAction = "update"
+	ChangeActionReplace ChangeAction = "replace"
+	ChangeActionDelete  ChangeAction = "delete"
+)
+
+func (a ChangeAction) Symbol() string {
+	switch a {
+	case ChangeActionCreate:
+		return "+"
+	case ChangeActionUpdate:
+		return "~"
+	case ChangeActionReplace:
+		return "-/+"
+	case ChangeActionDelete:
+		return "-"
+	}
+
+	return "?"
+}
+
+type ChangeTarget string
+
+const (
+	ChangeTargetPublisher  ChangeTarget = "publisher"
+	ChangeTargetSubscriber ChangeTarget = "subscriber"
+)
+
+// Change is a single step to reconcile the servers with the config.
+type Change struct {
+	Action ChangeAction
+	Target ChangeTarget
+	Kind   string
+	Name   string
+	DBName string
+
+	// AsDBOwner is true when the statements must be executed by the db owner instead of the super user.
+	AsDBOwner bool
+
+	// Reasons describes why the change is needed. It never contains credentials.
+	Reasons []string
+
+	// Destructive is true when the change breaks the running subscriptions while it's applied
+	// (e.g. replacing a publication makes the walsenders fail with "publication does not exist").
+	Destructive bool
+
+	SQL []string
+}
+
+type Plan struct {
+	Changes []Change
+
+	// Skipped is the destructive changes that are not applied without PlanOptions.Prune.
+	Skipped []Change
+}
+
+func (p Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+func (p Plan) Count(action ChangeAction) int {
+	var n int
+	for _, c := range p.Changes {
+		if c.Action == action {
+			n++
+		}
+	}
+
+	return n
+}
+
+func (p Plan) String() string {
+	var b strings.Builder
+
+	writeChange := func(c Change) {
+		fmt.Fprintf(&b, "  %s %s %q (%s/%s)\n", c.Action.Symbol(), c.Kind, c.Name, c.Target, c.DBName)
+		for _, r := range c.Reasons {
+			fmt.Fprintf(&b, "      %s\n", r)
+		}
+	}
+
+	if len(p.Skipped) > 0 {
+		fmt.Fprintf(&b, "Skipped the destructive changes (use --prune to apply them):\n")
+		for _, c := range p.Skipped {
+			writeChange(c)
+		}
+		fmt.Fprintf(&b, "\n")
+	}
+
+	if p.Empty() {
+		fmt.Fprintf(&b, "No changes. The servers match the configuration.\n")
+		return b.String()
+	}
+
+	for _, c := range p.Changes {
+		writeChange(c)
+	}
+
+	fmt.Fprintf(
+		&b,
+		"\nPlan: %d to add, %d to change, %d to replace, %d to destroy.\n",
+		p.Count(ChangeActionCreate),
+		p.Count(ChangeActionUpdate),
+		p.Count(ChangeActionReplace),
+		p.Count(ChangeActionDelete),
+	)
+
+	return b.String()
+}
+
+// PlanOptions controls how BuildPlan treats the objects that are not managed by the config.
+type PlanOptions struct {
+	// Prune drops the publications and subscriptions that are not in the config
+	// and applies the destructive changes (e.g. replacing a publication).
+	Prune bool
+}
+
+// BuildPlan compares the config with the state on the servers and returns the changes to apply.
+// pubConnForSub is used to build the connection for new subscriptions.
+func BuildPlan(cfg Config, st State, pubConnForSub UserInfo, opts PlanOptions) (Plan, error) {
+	var (
+		subDeletes []Change
+		pubDeletes []Change
+		pubChanges []Change
+		subChanges []Change
+		skipped    []Change
+	)
+
+	for _, dbName := range sortedKeys(cfg.Publications) {
+		pub := cfg.Publications[dbName]
+		pst := st.Publisher[dbName]
+
+		cur, ok := pst.Publications[pub.PubName]
+
+		switch {
+		case !ok:
+			pubChanges = append(pubChanges, Change{
+				Action:  ChangeActionCreate,
+				Target:  ChangeTargetPublisher,
+				Kind:    "publication",
+				Name:    pub.PubName,
+				DBName:  dbName,
+				Reasons: []string{"publication for all tables"},
+				SQL:     []string{CreatePublicationQuery(pub.PubName)},
+			})
+		case !cur.AllTables:
+			// ALTER PUBLICATION can't switch a publication to all tables
+			change := Change{
+				Action: ChangeActionReplace,
+				Target: ChangeTargetPublisher,
+				Kind:   "publication",
+				Name:   pub.PubName,
+				DBName: dbName,
+				Reasons: []string{
+					"publication is not for all tables",
+					"the subscriptions fail until the publication is created again",
+				},
+				Destructive: true,
+				SQL: []string{
+					DropPublicationQuery(pub.PubName),
+					CreatePublicationQuery(pub.PubName),
+				},
+			}
+
+			if opts.Prune {
+				pubChanges = append(pubChanges, change)
+			} else {
+				skipped = append(skipped, change)
+			}
+		}
+
+		for _, tbl := range pub.ReplicaIdentityFullTables {
+			if pst.ReplicaIdentityFull[tbl] {
+				continue
+			}
+
+			pubChanges = append(pubChanges, Change{
+				Action:    ChangeActionUpdate,
+				Target:    ChangeTargetPublisher,
+				Kind:      "table",
+				Name:      tbl.String(),
+				DBName:    dbName,
+				AsDBOwner: true,
+				Reasons:   []string{"replica identity: default => full"},
+				SQL:       []string{AlterTableReplicaIdentityFull(tbl)},
+			})
+		}
+
+		for _, name := range sortedKeys(pst.Publications) {
+			if !opts.Prune || name == pub.PubName {
+				continue
+			}
+
+			pubDeletes = append(pubDeletes, Change{
+				Action:  ChangeActionDelete,
+				Target:  ChangeTargetPublisher,
+				Kind:    "publication",
+				Name:    name,
+				DBName:  dbName,
+				Reasons: []string{"publication is not in the config"},
+				SQL:     []string{DropPublicationQuery(name)},
+			})
+		}
+	}
+
+	subsByDB := map[string]map[string]Subscription{}
+	for subName, sub := range cfg.Subscriptions {
+		if subsByDB[sub.DBName] == nil {
+			subsByDB[sub.DBName] = map[string]Subscription{}
+		}
+		subsByDB[sub.DBName][subName] = sub
+	}
+
+	for _, dbName := range sortedKeys(subsByDB) {
+		subs := subsByDB[dbName]
+		sst := st.Subscriber[dbName]
+
+		for _, subName := range sortedKeys(subs) {
+			sub := subs[subName]
+
+			cur, ok := sst.Subscriptions[subName]
+			if !ok {
+				connInfo, err := pubConnForSub.SubscriptionConnInfo(sub.DBName, sub)
+				if err != nil {
+					return Plan{}, err
+				}
+
+				subChanges = append(subChanges, Change{
+					Action:  ChangeActionCreate,
+					Target:  ChangeTargetSubscriber,
+					Kind:    "subscription",
+					Name:    subName,
+					DBName:  dbName,
+					Reasons: []string{fmt.Sprintf("publication: %q", sub.PubName)},
+					SQL: []string{
+						CreateSubscriptionQuery(
+							subName,
+							connInfo,
+							sub.PubName,
+							sub.PasswordRequired(),
+						),
+					},
+				})
+				continue
+			}
+
+			change := Change{
+				Action: ChangeActionUpdate,
+				Target: ChangeTargetSubscriber,
+				Kind:   "subscription",
+				Name:   subName,
+				DBName: dbName,
+			}
+
+			if len(cur.Publications) != 1 || cur.Publications[0] != sub.PubName {
+				change.Reasons = append(change.Reasons, fmt.Sprintf(
+					"publications: %q => %q", strings.Join(cur.Publications, ","), sub.PubName,
+				))
+				change.SQL = append(change.SQL, AlterSubscriptionSetPublicationQuery(subName, sub.PubName))
+			} else if missing := missingTables(st.Publisher[sub.DBName].Publications[sub.PubName].Tables, cur.Tables); len(missing) > 0 {
+				change.Reasons = append(change.Reasons, fmt.Sprintf(
+					"tables not subscribed yet: %s", strings.Join(missing, ", "),
+				))
+				change.SQL = append(change.SQL, AlterSubscriptionRefreshPublicationQuery(subName))
+			}
+
+			if sub.Enabled != nil && *sub.Enabled != cur.Enabled {
+				change.Reasons = append(change.Reasons, fmt.Sprintf("enabled: %t => %t", cur.Enabled, *sub.Enabled))
+				if *sub.Enabled {
+					change.SQL = append(change.SQL, AlterSubscriptionEnableQuery(subName))
+				} else {
+					change.SQL = append(change.SQL, DisableSubscriptionQuery(subName))
+				}
+			}
+
+			if len(change.SQL) > 0 {
+				subChanges = append(subChanges, change)
+			}
+		}
+
+		for _, name := range sortedKeys(sst.Subscriptions) {
+			if _, ok := subs[name]; ok || !opts.Prune {
+				continue
+			}
+
+			subDeletes = append(subDeletes, Change{
+				Action:  ChangeActionDelete,
+				Target:  ChangeTargetSubscriber,
+				Kind:    "subscription",
+				Name:    name,
+				DBName:  dbName,
+				Reasons: []string{"subscription is not in the config"},
+				SQL:     []string{DropSubscriptionQuery(name)},
+			})
+		}
+	}
+
+	// subscriptions must be dropped before their publications and created after them
+	var plan Plan
+	plan.Changes = append(plan.Changes, subDeletes...)
+	plan.Changes = append(plan.Changes, pubDeletes...)
+	plan.Changes = append(plan.Changes, pubChanges...)
+	plan.Changes = append(plan.Changes, subChanges...)
+	plan.Skipped = skipped
+
+	return plan, nil
+}
+
+func missingTables(published []QualifiedName, subscribed map[QualifiedName]string) []string {
+	var missing []string
+	for _, tbl := range published {
+		if _, ok := subscribed[tbl]; !ok {
+			missing = append(missing, tbl.String())
+		}
+	}
+
+	return missing
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,187 @@
+package flare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildPlan(t *testing.T) {
+	require := require.New(t)
+
+	cfg := Config{
+		Publications: map[string]Publication{
+			"bench": {
+				PubName:                   "bench",
+				ReplicaIdentityFullTables: []QualifiedName{{Name: "pgbench_history"}},
+			},
+		},
+		Subscriptions: map[string]Subscription{
+			"bench1": {DBName: "bench", PubName: "bench"},
+		},
+	}
+
+	pubConnForSub := ConnConfig{
+		SuperUser:         "postgres",
+		SuperUserPassword: Secret{Value: "password1"},
+		Host:              "publisher",
+		Port:              "5432",
+	}.SuperUserInfo()
+
+	t.Run("Empty", func(t *testing.T) {
+		plan, err := BuildPlan(cfg, State{}, pubConnForSub, PlanOptions{})
+		require.NoError(err)
+
+		require.Len(plan.Changes, 3)
+		require.Equal(ChangeActionCreate, plan.Changes[0].Action)
+		require.Equal("publication", plan.Changes[0].Kind)
+		require.Equal([]string{`CREATE PUBLICATION "bench" FOR ALL TABLES;`}, plan.Changes[0].SQL)
+
+		require.Equal("table", plan.Changes[1].Kind)
+		require.True(plan.Changes[1].AsDBOwner)
+
+		require.Equal(ChangeTargetSubscriber, plan.Changes[2].Target)
+		require.Equal(ChangeActionCreate, plan.Changes[2].Action)
+	})
+
+	t.Run("Drift", func(t *testing.T) {
+		st := State{
+			Publisher: map[string]PublisherDatabaseState{
+				"bench": {
+					DBName: "bench",
+					Publications: map[string]PublicationState{
+						"bench": {Name: "bench", AllTables: true, Tables: []QualifiedName{{Schema: "public", Name: "a.b"}, {Schema: "public", Name: "B"}}},
+						"old":   {Name: "old", AllTables: true},
+					},
+					ReplicaIdentityFull: map[QualifiedName]bool{{Name: "pgbench_history"}: true},
+				},
+			},
+			Subscriber: map[string]SubscriberDatabaseState{
+				"bench": {
+					DBName: "bench",
+					Subscriptions: map[string]SubscriptionState{
+						"bench1": {
+							Name:         "bench1",
+							Enabled:      false,
+							Publications: []string{"bench"},
+							Tables:       map[QualifiedName]string{{Schema: "public", Name: "a.b"}: "r"},
+						},
+						"bench0": {Name: "bench0", Enabled: true, Publications: []string{"old"}},
+					},
+				},
+			},
+		}
+
+		plan, err := BuildPlan(cfg, st, pubConnForSub, PlanOptions{})
+		require.NoError(err)
+
+		require.Len(plan.Changes, 1)
+		require.Equal(ChangeActionUpdate, plan.Changes[0].Action)
+		require.Equal([]string{"tables not subscribed yet: public.B"}, plan.Changes[0].Reasons)
+		require.Equal([]string{
+			`ALTER SUBSCRIPTION "bench1" REFRESH PUBLICATION;`,
+		}, plan.Changes[0].SQL)
+
+		plan, err = BuildPlan(cfg, st, pubConnForSub, PlanOptions{Prune: true})
+		require.NoError(err)
+
+		require.Len(plan.Changes, 3)
+
+		require.Equal(ChangeActionDelete, plan.Changes[0].Action)
+		require.Equal("bench0", plan.Changes[0].Name)
+
+		require.Equal(ChangeActionDelete, plan.Changes[1].Action)
+		require.Equal("old", plan.Changes[1].Name)
+
+		require.Contains(plan.String(), "Plan: 0 to add, 1 to change, 0 to replace, 2 to destroy.")
+
+		enabled := true
+		cfg := cfg
+		cfg.Subscriptions = map[string]Subscription{
+			"bench1": {DBName: "bench", PubName: "bench", Enabled: &enabled},
+		}
+
+		plan, err = BuildPlan(cfg, st, pubConnForSub, PlanOptions{})
+		require.NoError(err)
+
+		require.Len(plan.Changes, 1)
+		require.Equal([]string{
+			`ALTER SUBSCRIPTION "bench1" REFRESH PUBLICATION;`,
+			`ALTER SUBSCRIPTION "bench1" ENABLE;`,
+		}, plan.Changes[0].SQL)
+
+		cfg.Subscriptions = map[string]Subscription{
+			"bench2": {DBName: "bench", PubName: "bench", PasswordMode: "embedded"},
+		}
+
+		_, err = BuildPlan(cfg, st, pubConnForSub, PlanOptions{})
+		require.EqualError(err, "flare: unknown password_mode 'embedded'")
+	})
+
+	t.Run("Replace", func(t *testing.T) {
+		st := State{
+			Publisher: map[string]PublisherDatabaseState{
+				"bench": {
+					Publications:        map[string]PublicationState{"bench": {Name: "bench", Tables: []QualifiedName{{Schema: "public", Name: "a"}}}},
+					ReplicaIdentityFull: map[QualifiedName]bool{{Name: "pgbench_history"}: true},
+				},
+			},
+			Subscriber: map[string]SubscriberDatabaseState{
+				"bench": {
+					Subscriptions: map[string]SubscriptionState{
+						"bench1": {
+							Name:         "bench1",
+							Enabled:      true,
+							Publications: []string{"bench"},
+							Tables:       map[QualifiedName]string{{Schema: "public", Name: "a"}: "r"},
+						},
+					},
+				},
+			},
+		}
+
+		plan, err := BuildPlan(cfg, st, pubConnForSub, PlanOptions{})
+		require.NoError(err)
+		require.True(plan.Empty())
+		require.Len(plan.Skipped, 1)
+		require.True(plan.Skipped[0].Destructive)
+		require.Contains(plan.String(), "Skipped the destructive changes (use --prune to apply them):")
+
+		plan, err = BuildPlan(cfg, st, pubConnForSub, PlanOptions{Prune: true})
+		require.NoError(err)
+		require.Empty(plan.Skipped)
+		require.Len(plan.Changes, 1)
+		require.Equal(ChangeActionReplace, plan.Changes[0].Action)
+		require.Equal([]string{
+			`DROP PUBLICATION "bench";`,
+			`CREATE PUBLICATION "bench" FOR ALL TABLES;`,
+		}, plan.Changes[0].SQL)
+	})
+
+	t.Run("NoChanges", func(t *testing.T) {
+		st := State{
+			Publisher: map[string]PublisherDatabaseState{
+				"bench": {
+					Publications:        map[string]PublicationState{"bench": {Name: "bench", AllTables: true}},
+					ReplicaIdentityFull: map[QualifiedName]bool{{Name: "pgbench_history"}: true},
+				},
+			},
+			Subscriber: map[string]SubscriberDatabaseState{
+				"bench": {
+					Subscriptions: map[string]SubscriptionState{
+						"bench1": {
+							Name:         "bench1",
+							Enabled:      true,
+							Publications: []string{"bench"},
+							Tables:       map[QualifiedName]string{{Schema: "public", Name: "a"}: "r"},
+						},
+					},
+				},
+			},
+		}
+
+		plan, err := BuildPlan(cfg, st, pubConnForSub, PlanOptions{})
+		require.NoError(err)
+		require.True(plan.Empty())
+	})
+}
@@ -0,0 +1,99 @@
+package flare
+
+import (
+	"context"
+	"fmt"
+)
+
+// ReplicationUserQueries creates the replication user if missing and makes sure it can log in and replicate.
+// The password is set whether the role exists or not so that it matches the config. When the provider doesn't allow
+// REPLICATION, the role granted instead (e.g. rds_replication) is granted.
+func ReplicationUserQueries(role, verifier string, profile ProviderProfile) []string {
+	queries := []string{
+		fmt.Sprintf(
+			"DO $$ BEGIN IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = %s) THEN CREATE ROLE %s; END IF; END $$;",
+			quoteLiteral(role), quoteIdentifier(role),
+		),
+	}
+
+	if grant, ok := profile.AttributeGrants["REPLICATION"]; ok && containsAttribute(profile.StripAttributes, "REPLICATION") {
+		queries = append(queries,
+			fmt.Sprintf(`ALTER ROLE %s WITH LOGIN PASSWORD %s;`, quoteIdentifier(role), quoteLiteral(verifier)),
+			GrantRoleQuery(RoleMembership{Role: grant}, role),
+		)
+	} else {
+		queries = append(queries, fmt.Sprintf(
+			`ALTER ROLE %s WITH LOGIN REPLICATION PASSWORD %s;`,
+			quoteIdentifier(role), quoteLiteral(verifier),
+		))
+	}
+
+	return queries
+}
+
+// SchemaGrantQueries grants the least privileges to read the tables in the schema, including the tables
+// created later by the owners. The table sync in the subscriber only needs SELECT.
+func SchemaGrantQueries(schema, role string, owners []string) []string {
+	queries := []string{
+		fmt.Sprintf(`GRANT USAGE ON SCHEMA %s TO %s;`, quoteIdentifier(schema), quoteIdentifier(role)),
+		fmt.Sprintf(`GRANT SELECT ON ALL TABLES IN SCHEMA %s TO %s;`, quoteIdentifier(schema), quoteIdentifier(role)),
+	}
+
+	for _, owner := range owners {
+		queries = append(queries, fmt.Sprintf(
+			`ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA %s GRANT SELECT ON TABLES TO %s;`,
+			quoteIdentifier(owner), quoteIdentifier(schema), quoteIdentifier(role),
+		))
+	}
+
+	return queries
+}
+
+// ListPublishedSchemas returns the schemas that have the tables in the publication.
+func ListPublishedSchemas(ctx context.Context, conn *Conn, pubName string) ([]string, error) {
+	return queryStrings(
+		ctx, conn,
+		`SELECT DISTINCT schemaname FROM pg_publication_tables WHERE pubname = $1 ORDER BY schemaname;`,
+		pubName,
+	)
+}
+
+// ListUserSchemas returns the schemas except the system ones.
+// They are published when the publication is created FOR ALL TABLES.
+func ListUserSchemas(ctx context.Context, conn *Conn) ([]string, error) {
+	return queryStrings(
+		ctx, conn,
+		`SELECT nspname FROM pg_namespace WHERE nspname !~ '^pg_' AND nspname <> 'information_schema' ORDER BY nspname;`,
+	)
+}
+
+// ListTableOwners returns the owners of the tables in the schema.
+func ListTableOwners(ctx context.Context, conn *Conn, schema string) ([]string, error) {
+	return queryStrings(
+		ctx, conn,
+		`SELECT DISTINCT tableowner::text FROM pg_tables WHERE schemaname = $1 ORDER BY 1;`,
+		schema,
+	)
+}
+
+func queryStrings(ctx context.Context, conn *Conn, query string, args ...interface{}) ([]string, error) {
+	rows, err := conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("querying: %w", err)
+	}
+
+	defer rows.Close()
+
+	var ret []string
+
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, fmt.Errorf("scanning: %w", err)
+		}
+
+		ret = append(ret, s)
+	}
+
+	return ret, rows.Err()
+}
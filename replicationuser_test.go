@@ -0,0 +1,35 @@
+package flare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplicationUserQueries(t *testing.T) {
+	require := require.New(t)
+
+	create := `DO $$ BEGIN IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'repl') THEN CREATE ROLE "repl"; END IF; END $$;`
+
+	require.Equal([]string{
+		create,
+		`ALTER ROLE "repl" WITH LOGIN REPLICATION PASSWORD 'SCRAM-SHA-256$4096:salt$stored:server';`,
+	}, ReplicationUserQueries("repl", "SCRAM-SHA-256$4096:salt$stored:server", ProviderProfile{}))
+
+	require.Equal([]string{
+		create,
+		`ALTER ROLE "repl" WITH LOGIN PASSWORD 'SCRAM-SHA-256$4096:salt$stored:server';`,
+		`GRANT "rds_replication" TO "repl";`,
+	}, ReplicationUserQueries("repl", "SCRAM-SHA-256$4096:salt$stored:server", BuiltinProviderProfiles["rds"]))
+}
+
+func TestSchemaGrantQueries(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal([]string{
+		`GRANT USAGE ON SCHEMA "sales" TO "repl";`,
+		`GRANT SELECT ON ALL TABLES IN SCHEMA "sales" TO "repl";`,
+		`ALTER DEFAULT PRIVILEGES FOR ROLE "dbowner" IN SCHEMA "sales" GRANT SELECT ON TABLES TO "repl";`,
+		`ALTER DEFAULT PRIVILEGES FOR ROLE "app" IN SCHEMA "sales" GRANT SELECT ON TABLES TO "repl";`,
+	}, SchemaGrantQueries("sales", "repl", []string{"dbowner", "app"}))
+}
@@ -0,0 +1,305 @@
+package flare
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RoleMap maps the role names in the publisher to the ones in the subscriber.
+type RoleMap map[string]string
+
+// Map returns the name in the subscriber.
+func (m RoleMap) Map(name string) string {
+	if mapped, ok := m[name]; ok {
+		return mapped
+	}
+
+	return name
+}
+
+// Aliases returns the name and the names mapped from or to it so that either name can be given to the commands.
+func (m RoleMap) Aliases(name string) []string {
+	ret := []string{name}
+
+	add := func(n string) {
+		for _, r := range ret {
+			if r == n {
+				return
+			}
+		}
+		ret = append(ret, n)
+	}
+
+	add(m.Map(name))
+
+	for _, from := range sortedKeys(m) {
+		if m[from] == name {
+			add(from)
+		}
+	}
+
+	return ret
+}
+
+// RemapRoles renames the roles and the memberships.
+func RemapRoles(roles []Role, m RoleMap) []Role {
+	if len(m) == 0 {
+		return roles
+	}
+
+	var ret []Role
+
+	for _, r := range roles {
+		r.Name = m.Map(r.Name)
+
+		memberOf := make([]RoleMembership, 0, len(r.MemberOf))
+		for _, ms := range r.MemberOf {
+			ms.Role = m.Map(ms.Role)
+			memberOf = append(memberOf, ms)
+		}
+
+		if len(r.MemberOf) == 0 {
+			memberOf = nil
+		}
+
+		r.MemberOf = memberOf
+
+		ret = append(ret, r)
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Name < ret[j].Name })
+
+	return ret
+}
+
+// RemapRoleNames rewrites the role names in the output of pg_dump and pg_dumpall.
+// The roles are renamed in CREATE/ALTER/COMMENT ON ROLE, OWNER (TO), AUTHORIZATION, GRANT/REVOKE including
+// the role memberships and GRANTED BY, ALTER DEFAULT PRIVILEGES FOR ROLE and CREATE/ALTER POLICY ... TO.
+func RemapRoleNames(sql string, m RoleMap) (string, error) {
+	if len(m) == 0 {
+		return sql, nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(sql))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	var b strings.Builder
+
+	for scanner.Scan() {
+		fmt.Fprintf(&b, "%s\n", remapRoleNamesInLine(scanner.Text(), m))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("scanning the SQL: %w", err)
+	}
+
+	return b.String(), nil
+}
+
+type sqlTokenKind int
+
+const (
+	sqlTokenWord sqlTokenKind = iota
+	sqlTokenQuotedIdent
+	sqlTokenLiteral
+	sqlTokenPunct
+)
+
+type sqlToken struct {
+	kind       sqlTokenKind
+	start, end int
+	text       string
+}
+
+// name returns the name with the quotes removed. pg_dump writes SET SESSION AUTHORIZATION with a literal.
+func (t sqlToken) name() string {
+	switch t.kind {
+	case sqlTokenWord:
+		return t.text
+	case sqlTokenQuotedIdent:
+		return unquoteIdentifier(t.text)
+	case sqlTokenLiteral:
+		if len(t.text) >= 2 && strings.HasSuffix(t.text, "'") {
+			return strings.ReplaceAll(t.text[1:len(t.text)-1], "''", "'")
+		}
+	}
+
+	return ""
+}
+
+func (t sqlToken) isKeyword(kw string) bool {
+	return t.kind == sqlTokenWord && strings.EqualFold(t.text, kw)
+}
+
+func tokenizeSQLLine(line string) []sqlToken {
+	var tokens []sqlToken
+
+	isWord := func(c byte) bool {
+		return c == '_' || c == '$' || c >= 0x80 ||
+			('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+	}
+
+	// scanQuoted returns the end of the quoted string starting at i. The doubled quotes are escaped quotes.
+	scanQuoted := func(i int, q byte) int {
+		for j := i + 1; j < len(line); j++ {
+			if line[j] != q {
+				continue
+			}
+
+			if j+1 < len(line) && line[j+1] == q {
+				j++
+				continue
+			}
+
+			return j + 1
+		}
+
+		return len(line)
+	}
+
+	for i := 0; i < len(line); {
+		c := line[i]
+
+		var kind sqlTokenKind
+		var end int
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\r':
+			i++
+			continue
+		case c == '-' && strings.HasPrefix(line[i:], "--"):
+			return tokens
+		case c == '\'':
+			kind, end = sqlTokenLiteral, scanQuoted(i, '\'')
+		case c == '"':
+			kind, end = sqlTokenQuotedIdent, scanQuoted(i, '"')
+		case isWord(c):
+			end = i
+			for end < len(line) && isWord(line[end]) {
+				end++
+			}
+			kind = sqlTokenWord
+		default:
+			kind, end = sqlTokenPunct, i+1
+		}
+
+		tokens = append(tokens, sqlToken{kind: kind, start: i, end: end, text: line[i:end]})
+		i = end
+	}
+
+	return tokens
+}
+
+func remapRoleNamesInLine(line string, m RoleMap) string {
+	tokens := tokenizeSQLLine(line)
+	if len(tokens) == 0 {
+		return line
+	}
+
+	kw := func(i int, words ...string) bool {
+		if i < 0 || i+len(words) > len(tokens) {
+			return false
+		}
+
+		for j, w := range words {
+			if !tokens[i+j].isKeyword(w) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	hasKeyword := func(word string) bool {
+		for _, t := range tokens {
+			if t.isKeyword(word) {
+				return true
+			}
+		}
+		return false
+	}
+
+	isGrant := kw(0, "GRANT") || (kw(0, "ALTER", "DEFAULT", "PRIVILEGES") && hasKeyword("GRANT"))
+	isRevoke := kw(0, "REVOKE") || (kw(0, "ALTER", "DEFAULT", "PRIVILEGES") && hasKeyword("REVOKE"))
+	isPolicy := kw(0, "CREATE", "POLICY") || kw(0, "ALTER", "POLICY")
+
+	// GRANT role TO role and REVOKE role FROM role don't have ON
+	isMembership := (kw(0, "GRANT") || kw(0, "REVOKE")) && !hasKeyword("ON")
+
+	roleAt := map[int]bool{}
+
+	// markList marks the comma-separated identifiers starting at i as the roles
+	markList := func(i int) {
+		for i < len(tokens) {
+			if kw(i, "GROUP") || kw(i, "ROLE") {
+				i++
+				continue
+			}
+
+			roleAt[i] = true
+
+			if i+1 < len(tokens) && tokens[i+1].kind == sqlTokenPunct && tokens[i+1].text == "," {
+				i += 2
+				continue
+			}
+
+			return
+		}
+	}
+
+	if isMembership {
+		markList(1)
+	}
+
+	for i := range tokens {
+		switch {
+		case kw(i, "ROLE"):
+			markList(i + 1)
+		case kw(i, "OWNER", "TO"):
+			markList(i + 2)
+		case kw(i, "OWNER") && kw(0, "CREATE"):
+			// CREATE TABLESPACE ... OWNER role and CREATE DATABASE ... OWNER = role
+			if i+1 < len(tokens) && tokens[i+1].kind == sqlTokenPunct && tokens[i+1].text == "=" {
+				markList(i + 2)
+			} else {
+				markList(i + 1)
+			}
+		case kw(i, "AUTHORIZATION"):
+			markList(i + 1)
+		case kw(i, "GRANTED", "BY"):
+			markList(i + 2)
+		case kw(i, "TO") && (isGrant || isPolicy) && !kw(i-1, "OWNER") && !kw(i-1, "RENAME"):
+			markList(i + 1)
+		case kw(i, "FROM") && isRevoke:
+			markList(i + 1)
+		}
+	}
+
+	var b strings.Builder
+	last := 0
+
+	for i, t := range tokens {
+		if !roleAt[i] {
+			continue
+		}
+
+		mapped, ok := m[t.name()]
+		if !ok || t.kind == sqlTokenPunct {
+			continue
+		}
+
+		b.WriteString(line[last:t.start])
+		if t.kind == sqlTokenLiteral {
+			b.WriteString(quoteLiteral(mapped))
+		} else {
+			b.WriteString(quoteIdentifier(mapped))
+		}
+		last = t.end
+	}
+
+	b.WriteString(line[last:])
+
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package flare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoleMap(t *testing.T) {
+	require := require.New(t)
+
+	m := RoleMap{"postgres": "admin", "app": "app_rw"}
+
+	require.Equal("admin", m.Map("postgres"))
+	require.Equal("readers", m.Map("readers"))
+
+	require.Equal([]string{"app", "app_rw"}, m.Aliases("app"))
+	require.Equal([]string{"app_rw", "app"}, m.Aliases("app_rw"))
+	require.Equal([]string{"readers"}, m.Aliases("readers"))
+
+	roles := RemapRoles([]Role{
+		{Name: "app", MemberOf: []RoleMembership{{Role: "readers"}, {Role: "postgres"}}},
+		{Name: "readers"},
+	}, m)
+
+	require.Equal([]Role{
+		{Name: "app_rw", MemberOf: []RoleMembership{{Role: "readers"}, {Role: "admin"}}},
+		{Name: "readers"},
+	}, roles)
+}
+
+func TestRemapRoleNames(t *testing.T) {
+	input := `CREATE ROLE app;
+ALTER ROLE app WITH NOSUPERUSER INHERIT NOCREATEROLE NOCREATEDB LOGIN NOREPLICATION NOBYPASSRLS;
+COMMENT ON ROLE app IS 'the app user';
+GRANT readers TO app GRANTED BY postgres;
+ALTER ROLE app SET search_path TO 'app';
+SET SESSION AUTHORIZATION 'app';
+CREATE SCHEMA sales AUTHORIZATION app;
+CREATE TABLESPACE fast OWNER postgres LOCATION '/mnt/fast';
+CREATE DATABASE bench WITH TEMPLATE = template0 ENCODING = 'UTF8' OWNER = app;
+ALTER TABLE public.app OWNER TO app;
+ALTER TABLE public.items OWNER TO "postgres";
+GRANT SELECT,INSERT ON TABLE public.items TO app, readers;
+REVOKE ALL ON TABLE public.items FROM app;
+ALTER DEFAULT PRIVILEGES FOR ROLE postgres IN SCHEMA public GRANT SELECT ON TABLES TO app;
+CREATE POLICY app ON public.items FOR SELECT TO app USING ((owner = CURRENT_USER));
+ALTER POLICY app ON public.items RENAME TO app2;
+-- Name: app; Type: TABLE; Schema: public; Owner: app
+`
+	expected := `CREATE ROLE "app_rw";
+ALTER ROLE "app_rw" WITH NOSUPERUSER INHERIT NOCREATEROLE NOCREATEDB LOGIN NOREPLICATION NOBYPASSRLS;
+COMMENT ON ROLE "app_rw" IS 'the app user';
+GRANT readers TO "app_rw" GRANTED BY "admin";
+ALTER ROLE "app_rw" SET search_path TO 'app';
+SET SESSION AUTHORIZATION 'app_rw';
+CREATE SCHEMA sales AUTHORIZATION "app_rw";
+CREATE TABLESPACE fast OWNER "admin" LOCATION '/mnt/fast';
+CREATE DATABASE bench WITH TEMPLATE = template0 ENCODING = 'UTF8' OWNER = "app_rw";
+ALTER TABLE public.app OWNER TO "app_rw";
+ALTER TABLE public.items OWNER TO "admin";
+GRANT SELECT,INSERT ON TABLE public.items TO "app_rw", readers;
+REVOKE ALL ON TABLE public.items FROM "app_rw";
+ALTER DEFAULT PRIVILEGES FOR ROLE "admin" IN SCHEMA public GRANT SELECT ON TABLES TO "app_rw";
+CREATE POLICY app ON public.items FOR SELECT TO "app_rw" USING ((owner = CURRENT_USER));
+ALTER POLICY app ON public.items RENAME TO app2;
+-- Name: app; Type: TABLE; Schema: public; Owner: app
+`
+
+	require := require.New(t)
+
+	actual, err := RemapRoleNames(input, RoleMap{"postgres": "admin", "app": "app_rw"})
+	require.NoError(err)
+	require.Equal(expected, actual)
+}
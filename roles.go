@@ -0,0 +1,551 @@
+package flare
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgtype/zeronull"
+)
+
+type Role struct {
+	Name string
+
+	SuperUser   bool
+	Inherit     bool
+	CreateRole  bool
+	CreateDB    bool
+	CanLogin    bool
+	Replication bool
+	BypassRLS   bool
+
+	ConnLimit  int
+	ValidUntil string
+
+	MemberOf []RoleMembership
+	Settings []RoleSetting
+}
+
+type RoleMembership struct {
+	Role        string
+	AdminOption bool
+}
+
+type RoleSetting struct {
+	// DBName is empty when the setting applies to all the databases.
+	DBName string
+	Name   string
+	Value  string
+}
+
+// Attributes returns the role attributes in the form of ALTER ROLE except the ones in skip.
+// The number and the order of the attributes are always the same for the same skip.
+func (r Role) Attributes(skip []string) []string {
+	flag := func(v bool, name string) string {
+		if v {
+			return name
+		}
+		return "NO" + name
+	}
+
+	attrs := []string{
+		flag(r.SuperUser, "SUPERUSER"),
+		flag(r.Inherit, "INHERIT"),
+		flag(r.CreateRole, "CREATEROLE"),
+		flag(r.CreateDB, "CREATEDB"),
+		flag(r.CanLogin, "LOGIN"),
+		flag(r.Replication, "REPLICATION"),
+		flag(r.BypassRLS, "BYPASSRLS"),
+	}
+
+	var ret []string
+	for _, attr := range attrs {
+		if containsAttribute(skip, attr) {
+			continue
+		}
+
+		ret = append(ret, attr)
+	}
+
+	if !containsAttribute(skip, "CONNECTION LIMIT") {
+		ret = append(ret, fmt.Sprintf("CONNECTION LIMIT %d", r.ConnLimit))
+	}
+
+	if !containsAttribute(skip, "VALID UNTIL") {
+		validUntil := r.ValidUntil
+		if validUntil == "" {
+			validUntil = "infinity"
+		}
+
+		ret = append(ret, fmt.Sprintf("VALID UNTIL %s", quoteLiteral(validUntil)))
+	}
+
+	return ret
+}
+
+// containsAttribute reports whether attr is in skip. `SUPERUSER` in skip matches both `SUPERUSER` and `NOSUPERUSER`.
+func containsAttribute(skip []string, attr string) bool {
+	for _, s := range skip {
+		s = strings.ToUpper(s)
+		if s == attr || "NO"+s == attr {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ListRoles(ctx context.Context, conn *Conn) ([]Role, error) {
+	rows, err := conn.Query(ctx, `
+SELECT
+	  rolname
+	, rolsuper
+	, rolinherit
+	, rolcreaterole
+	, rolcreatedb
+	, rolcanlogin
+	, rolreplication
+	, rolbypassrls
+	, rolconnlimit
+	, rolvaliduntil::text
+FROM pg_roles
+WHERE rolname !~ '^pg_'
+ORDER BY rolname
+;
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("querying the roles: %w", err)
+	}
+
+	var roles []Role
+	idx := map[string]int{}
+
+	for rows.Next() {
+		var (
+			r          Role
+			validUntil zeronull.Text
+		)
+
+		if err := rows.Scan(
+			&r.Name,
+			&r.SuperUser,
+			&r.Inherit,
+			&r.CreateRole,
+			&r.CreateDB,
+			&r.CanLogin,
+			&r.Replication,
+			&r.BypassRLS,
+			&r.ConnLimit,
+			&validUntil,
+		); err != nil {
+			return nil, fmt.Errorf("scanning the role: %w", err)
+		}
+
+		r.ValidUntil = string(validUntil)
+
+		idx[r.Name] = len(roles)
+		roles = append(roles, r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("scanning the roles: %w", err)
+	}
+
+	if err := listRoleMemberships(ctx, conn, roles, idx); err != nil {
+		return nil, err
+	}
+
+	if err := listRoleSettings(ctx, conn, roles, idx); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func listRoleMemberships(ctx context.Context, conn *Conn, roles []Role, idx map[string]int) error {
+	rows, err := conn.Query(ctx, `
+SELECT m.rolname, r.rolname, am.admin_option
+FROM pg_auth_members am
+JOIN pg_roles r ON r.oid = am.roleid
+JOIN pg_roles m ON m.oid = am.member
+ORDER BY m.rolname, r.rolname
+;
+	`)
+	if err != nil {
+		return fmt.Errorf("querying the role memberships: %w", err)
+	}
+
+	for rows.Next() {
+		var (
+			member string
+			ms     RoleMembership
+		)
+
+		if err := rows.Scan(&member, &ms.Role, &ms.AdminOption); err != nil {
+			return fmt.Errorf("scanning the role membership: %w", err)
+		}
+
+		if i, ok := idx[member]; ok {
+			roles[i].MemberOf = append(roles[i].MemberOf, ms)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("scanning the role memberships: %w", err)
+	}
+
+	return nil
+}
+
+func listRoleSettings(ctx context.Context, conn *Conn, roles []Role, idx map[string]int) error {
+	rows, err := conn.Query(ctx, `
+SELECT r.rolname, COALESCE(d.datname, ''), cfg.setting
+FROM pg_db_role_setting s
+JOIN pg_roles r ON r.oid = s.setrole
+LEFT JOIN pg_database d ON d.oid = s.setdatabase
+CROSS JOIN LATERAL unnest(s.setconfig) AS cfg(setting)
+ORDER BY r.rolname, 2, cfg.setting
+;
+	`)
+	if err != nil {
+		return fmt.Errorf("querying the role settings: %w", err)
+	}
+
+	for rows.Next() {
+		var (
+			roleName string
+			st       RoleSetting
+			setting  string
+		)
+
+		if err := rows.Scan(&roleName, &st.DBName, &setting); err != nil {
+			return fmt.Errorf("scanning the role setting: %w", err)
+		}
+
+		st.Name, st.Value, _ = strings.Cut(setting, "=")
+
+		if i, ok := idx[roleName]; ok {
+			roles[i].Settings = append(roles[i].Settings, st)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("scanning the role settings: %w", err)
+	}
+
+	return nil
+}
+
+// FilterRoles returns the roles whose name doesn't match any of the patterns in path.Match syntax.
+func FilterRoles(roles []Role, excludes []string) ([]Role, error) {
+	var ret []Role
+
+	for _, r := range roles {
+		excluded, err := matchAny(excludes, r.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		if excluded {
+			continue
+		}
+
+		ret = append(ret, r)
+	}
+
+	return ret, nil
+}
+
+func matchAny(patterns []string, name string) (bool, error) {
+	for _, p := range patterns {
+		matched, err := path.Match(p, name)
+		if err != nil {
+			return false, fmt.Errorf("matching '%s' with '%s': %w", name, p, err)
+		}
+
+		if matched {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+type RoleSQLOptions struct {
+	// SkipAttributes holds the attributes that are not allowed in the target (e.g. SUPERUSER).
+	SkipAttributes []string
+}
+
+// RolesSQL generates SQL that can be run repeatedly to create the roles, alter the attributes,
+// add the memberships and set the settings. The memberships are granted after all the roles are created.
+func RolesSQL(roles []Role, opts RoleSQLOptions) string {
+	var b strings.Builder
+
+	for _, r := range roles {
+		fmt.Fprintf(
+			&b,
+			"DO $$ BEGIN IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = %s) THEN CREATE ROLE %s; END IF; END $$;\n",
+			quoteLiteral(r.Name), quoteIdentifier(r.Name),
+		)
+		fmt.Fprintf(&b, "ALTER ROLE %s WITH %s;\n", quoteIdentifier(r.Name), strings.Join(r.Attributes(opts.SkipAttributes), " "))
+	}
+
+	for _, r := range roles {
+		for _, ms := range r.MemberOf {
+			fmt.Fprintf(&b, "%s\n", GrantRoleQuery(ms, r.Name))
+		}
+	}
+
+	for _, r := range roles {
+		for _, st := range r.Settings {
+			fmt.Fprintf(&b, "%s\n", AlterRoleSetQuery(r.Name, st))
+		}
+	}
+
+	return b.String()
+}
+
+func GrantRoleQuery(ms RoleMembership, member string) string {
+	q := fmt.Sprintf(`GRANT %s TO %s`, quoteIdentifier(ms.Role), quoteIdentifier(member))
+	if ms.AdminOption {
+		q += " WITH ADMIN OPTION"
+	}
+
+	return q + ";"
+}
+
+// listSettings are the settings whose value is a list. Each element must be quoted separately.
+var listSettings = map[string]bool{
+	"search_path":               true,
+	"temp_tablespaces":          true,
+	"local_preload_libraries":   true,
+	"session_preload_libraries": true,
+}
+
+func AlterRoleSetQuery(role string, st RoleSetting) string {
+	var in string
+	if st.DBName != "" {
+		in = " IN DATABASE " + quoteIdentifier(st.DBName)
+	}
+
+	value := quoteLiteral(st.Value)
+
+	if listSettings[st.Name] {
+		if list, err := splitListSetting(st.Value); err == nil {
+			var elems []string
+			for _, e := range list {
+				elems = append(elems, quoteLiteral(e))
+			}
+
+			value = strings.Join(elems, ", ")
+		}
+	}
+
+	return fmt.Sprintf(`ALTER ROLE %s%s SET %s TO %s;`, quoteIdentifier(role), in, st.Name, value)
+}
+
+// splitListSetting splits the value of the list setting as PostgreSQL does (SplitIdentifierString):
+// the elements are separated by commas and the double-quoted elements may contain commas and doubled quotes.
+func splitListSetting(value string) ([]string, error) {
+	var elems []string
+
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+	}
+
+	i := 0
+	skipSpaces := func() {
+		for i < len(value) && isSpace(value[i]) {
+			i++
+		}
+	}
+
+	skipSpaces()
+	if i == len(value) {
+		return nil, nil
+	}
+
+	for {
+		var elem strings.Builder
+
+		if i < len(value) && value[i] == '"' {
+			i++
+			for {
+				if i >= len(value) {
+					return nil, fmt.Errorf("unterminated quoted element in '%s'", value)
+				}
+
+				if value[i] == '"' {
+					if i+1 < len(value) && value[i+1] == '"' {
+						elem.WriteByte('"')
+						i += 2
+						continue
+					}
+
+					i++
+					break
+				}
+
+				elem.WriteByte(value[i])
+				i++
+			}
+		} else {
+			for i < len(value) && value[i] != ',' && !isSpace(value[i]) {
+				elem.WriteByte(value[i])
+				i++
+			}
+		}
+
+		if elem.Len() == 0 {
+			return nil, fmt.Errorf("empty element in '%s'", value)
+		}
+
+		elems = append(elems, elem.String())
+
+		skipSpaces()
+		if i == len(value) {
+			return elems, nil
+		}
+
+		if value[i] != ',' {
+			return nil, fmt.Errorf("malformed list '%s'", value)
+		}
+
+		i++
+		skipSpaces()
+	}
+}
+
+type RoleDiff struct {
+	Action ChangeAction
+	Role   string
+	Detail string
+}
+
+func (d RoleDiff) String() string {
+	return fmt.Sprintf("%s role %q: %s", d.Action.Symbol(), d.Role, d.Detail)
+}
+
+// DiffRoles compares the roles in src with the roles in dst.
+func DiffRoles(src, dst []Role, opts RoleSQLOptions) []RoleDiff {
+	dstByName := map[string]Role{}
+	for _, r := range dst {
+		dstByName[r.Name] = r
+	}
+
+	srcByName := map[string]Role{}
+
+	var diffs []RoleDiff
+
+	for _, sr := range src {
+		srcByName[sr.Name] = sr
+
+		dr, ok := dstByName[sr.Name]
+		if !ok {
+			diffs = append(diffs, RoleDiff{
+				Action: ChangeActionCreate,
+				Role:   sr.Name,
+				Detail: "missing in the subscriber",
+			})
+			continue
+		}
+
+		sattrs := sr.Attributes(opts.SkipAttributes)
+		dattrs := dr.Attributes(opts.SkipAttributes)
+		for i := range sattrs {
+			if sattrs[i] != dattrs[i] {
+				diffs = append(diffs, RoleDiff{
+					Action: ChangeActionUpdate,
+					Role:   sr.Name,
+					Detail: fmt.Sprintf("%s => %s", dattrs[i], sattrs[i]),
+				})
+			}
+		}
+
+		for _, ms := range sr.MemberOf {
+			if !containsMembership(dr.MemberOf, ms) {
+				diffs = append(diffs, RoleDiff{
+					Action: ChangeActionUpdate,
+					Role:   sr.Name,
+					Detail: fmt.Sprintf("missing membership in %q (admin option: %t)", ms.Role, ms.AdminOption),
+				})
+			}
+		}
+
+		for _, ms := range dr.MemberOf {
+			if !containsMembership(sr.MemberOf, ms) {
+				diffs = append(diffs, RoleDiff{
+					Action: ChangeActionUpdate,
+					Role:   sr.Name,
+					Detail: fmt.Sprintf("extra membership in %q only in the subscriber", ms.Role),
+				})
+			}
+		}
+
+		for _, st := range sr.Settings {
+			if !containsSetting(dr.Settings, st) {
+				diffs = append(diffs, RoleDiff{
+					Action: ChangeActionUpdate,
+					Role:   sr.Name,
+					Detail: fmt.Sprintf("missing setting %s", formatRoleSetting(st)),
+				})
+			}
+		}
+
+		for _, st := range dr.Settings {
+			if !containsSetting(sr.Settings, st) {
+				diffs = append(diffs, RoleDiff{
+					Action: ChangeActionUpdate,
+					Role:   sr.Name,
+					Detail: fmt.Sprintf("extra setting %s only in the subscriber", formatRoleSetting(st)),
+				})
+			}
+		}
+	}
+
+	for _, dr := range dst {
+		if _, ok := srcByName[dr.Name]; !ok {
+			diffs = append(diffs, RoleDiff{
+				Action: ChangeActionDelete,
+				Role:   dr.Name,
+				Detail: "exists only in the subscriber",
+			})
+		}
+	}
+
+	sort.SliceStable(diffs, func(i, j int) bool {
+		return diffs[i].Role < diffs[j].Role
+	})
+
+	return diffs
+}
+
+func containsMembership(mss []RoleMembership, ms RoleMembership) bool {
+	for _, m := range mss {
+		if m == ms {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsSetting(sts []RoleSetting, st RoleSetting) bool {
+	for _, s := range sts {
+		if s == st {
+			return true
+		}
+	}
+
+	return false
+}
+
+func formatRoleSetting(st RoleSetting) string {
+	if st.DBName == "" {
+		return fmt.Sprintf("%s=%s", st.Name, st.Value)
+	}
+
+	return fmt.Sprintf("%s=%s in %q", st.Name, st.Value, st.DBName)
+}
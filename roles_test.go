@@ -0,0 +1,94 @@
+package flare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRolesSQL(t *testing.T) {
+	require := require.New(t)
+
+	roles := []Role{
+		{
+			Name:      "app",
+			Inherit:   true,
+			CanLogin:  true,
+			ConnLimit: -1,
+			MemberOf:  []RoleMembership{{Role: "readers"}},
+			Settings: []RoleSetting{
+				{Name: "search_path", Value: `"$user", public`},
+				{DBName: "bench", Name: "statement_timeout", Value: "5s"},
+			},
+		},
+		{
+			Name:      "readers",
+			Inherit:   true,
+			ConnLimit: -1,
+		},
+	}
+
+	expected := `DO $$ BEGIN IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'app') THEN CREATE ROLE "app"; END IF; END $$;
+ALTER ROLE "app" WITH INHERIT NOCREATEROLE NOCREATEDB LOGIN NOBYPASSRLS CONNECTION LIMIT -1 VALID UNTIL 'infinity';
+DO $$ BEGIN IF NOT EXISTS (SELECT FROM pg_roles WHERE rolname = 'readers') THEN CREATE ROLE "readers"; END IF; END $$;
+ALTER ROLE "readers" WITH INHERIT NOCREATEROLE NOCREATEDB NOLOGIN NOBYPASSRLS CONNECTION LIMIT -1 VALID UNTIL 'infinity';
+GRANT "readers" TO "app";
+ALTER ROLE "app" SET search_path TO '$user', 'public';
+ALTER ROLE "app" IN DATABASE "bench" SET statement_timeout TO '5s';
+`
+
+	require.Equal(expected, RolesSQL(roles, RoleSQLOptions{SkipAttributes: []string{"SUPERUSER", "REPLICATION"}}))
+}
+
+func TestDiffRoles(t *testing.T) {
+	require := require.New(t)
+
+	src := []Role{
+		{Name: "app", CanLogin: true, MemberOf: []RoleMembership{{Role: "readers"}}},
+		{Name: "dbowner", CreateDB: true, CanLogin: true},
+		{Name: "readers"},
+	}
+
+	dst := []Role{
+		{Name: "app", CanLogin: false},
+		{Name: "old"},
+		{Name: "readers"},
+	}
+
+	diffs := DiffRoles(src, dst, RoleSQLOptions{})
+
+	require.Equal([]RoleDiff{
+		{Action: ChangeActionUpdate, Role: "app", Detail: "NOLOGIN => LOGIN"},
+		{Action: ChangeActionUpdate, Role: "app", Detail: `missing membership in "readers" (admin option: false)`},
+		{Action: ChangeActionCreate, Role: "dbowner", Detail: "missing in the subscriber"},
+		{Action: ChangeActionDelete, Role: "old", Detail: "exists only in the subscriber"},
+	}, diffs)
+}
+
+func TestFilterRoles(t *testing.T) {
+	require := require.New(t)
+
+	roles, err := FilterRoles([]Role{{Name: "app"}, {Name: "rdsadmin"}, {Name: "rds_superuser"}}, []string{"rds*"})
+	require.NoError(err)
+	require.Equal([]Role{{Name: "app"}}, roles)
+}
+
+func TestAlterRoleSetQuery(t *testing.T) {
+	require := require.New(t)
+
+	require.Equal(
+		`ALTER ROLE "app" SET search_path TO 'a,b', 'Say "hi"', 'public';`,
+		AlterRoleSetQuery("app", RoleSetting{Name: "search_path", Value: `"a,b", "Say ""hi""",public`}),
+	)
+
+	require.Equal(
+		`ALTER ROLE "app" SET session_preload_libraries TO 'auto_explain';`,
+		AlterRoleSetQuery("app", RoleSetting{Name: "session_preload_libraries", Value: "auto_explain"}),
+	)
+
+	// the malformed value is set as it is
+	require.Equal(
+		`ALTER ROLE "app" SET search_path TO '"unterminated';`,
+		AlterRoleSetQuery("app", RoleSetting{Name: "search_path", Value: `"unterminated`}),
+	)
+}
@@ -0,0 +1,219 @@
+package flare
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgpassfile"
+)
+
+// Secret is a password in the config. A string is always the password itself.
+// A mapping refers to the secret outside the config with from:
+//
+//   - env reads the environment variable
+//   - file reads the file (e.g. a mounted secret)
+//   - pgpass looks up .pgpass (the value, PGPASSFILE or ~/.pgpass by default) for the host, the port and the user
+//     with the database "postgres" since the password is used for all the databases (only "*" or "postgres" entries match)
+//   - exec runs the command with `sh -c` and reads the standard output
+//
+// The trailing newline is removed from the file and the command output. For example:
+//
+//	superuser_password:
+//	  from: env
+//	  value: PUBLISHER_SUPERUSER_PASSWORD
+type Secret struct {
+	From  string `yaml:"from"`
+	Value string `yaml:"value"`
+}
+
+// registerSecretType lets validator check the password fields with the struct tags (e.g. required)
+// since validator doesn't check required on the struct fields.
+func registerSecretType(v *validator.Validate) {
+	v.RegisterCustomTypeFunc(func(f reflect.Value) interface{} {
+		s, ok := f.Interface().(Secret)
+		return ok && !s.IsZero()
+	}, Secret{})
+}
+
+const (
+	SecretFromEnv    = "env"
+	SecretFromFile   = "file"
+	SecretFromPGPass = "pgpass"
+	SecretFromExec   = "exec"
+)
+
+// IsZero returns true if neither the password nor the reference is set.
+func (s Secret) IsZero() bool {
+	return s.From == "" && s.Value == ""
+}
+
+func (s *Secret) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var plain string
+	if err := unmarshal(&plain); err == nil {
+		*s = Secret{Value: plain}
+		return nil
+	}
+
+	type secret Secret
+
+	var ref secret
+	if err := unmarshal(&ref); err != nil {
+		return err
+	}
+
+	switch ref.From {
+	case SecretFromEnv, SecretFromFile, SecretFromPGPass, SecretFromExec:
+	case "":
+		return fmt.Errorf("flare: 'from' is required in the secret reference")
+	default:
+		return fmt.Errorf("flare: unknown secret source '%s' (env, file, pgpass or exec)", ref.From)
+	}
+
+	*s = Secret(ref)
+
+	return nil
+}
+
+func (s Secret) MarshalYAML() (interface{}, error) {
+	if s.From == "" {
+		return s.Value, nil
+	}
+
+	type secret Secret
+
+	return secret(s), nil
+}
+
+// PGPassKey is the key to look up .pgpass.
+type PGPassKey struct {
+	Host string
+	Port string
+	User string
+}
+
+// Resolve returns the secret. The errors never contain the secret.
+func (s Secret) Resolve(ctx context.Context, key PGPassKey) (string, error) {
+	var secret string
+
+	switch s.From {
+	case "":
+		return s.Value, nil
+
+	case SecretFromEnv:
+		v, ok := os.LookupEnv(s.Value)
+		if !ok {
+			return "", fmt.Errorf("flare: environment variable %s is not set", s.Value)
+		}
+
+		secret = v
+
+	case SecretFromFile:
+		b, err := os.ReadFile(s.Value)
+		if err != nil {
+			return "", fmt.Errorf("reading the secret file: %w", err)
+		}
+
+		secret = strings.TrimRight(string(b), "\r\n")
+
+	case SecretFromPGPass:
+		v, err := lookupPGPass(s.Value, key)
+		if err != nil {
+			return "", err
+		}
+
+		secret = v
+
+	case SecretFromExec:
+		v, err := runSecretCommand(ctx, s.Value)
+		if err != nil {
+			return "", err
+		}
+
+		secret = v
+
+	default:
+		return "", fmt.Errorf("flare: unknown secret source '%s'", s.From)
+	}
+
+	if secret == "" {
+		return "", fmt.Errorf("flare: the secret is empty")
+	}
+
+	return secret, nil
+}
+
+func lookupPGPass(fn string, key PGPassKey) (string, error) {
+	if fn == "" {
+		fn = os.Getenv("PGPASSFILE")
+	}
+
+	if fn == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("looking up the home directory for .pgpass: %w", err)
+		}
+
+		fn = filepath.Join(home, ".pgpass")
+	}
+
+	passfile, err := pgpassfile.ReadPassfile(fn)
+	if err != nil {
+		return "", fmt.Errorf("reading .pgpass: %w", err)
+	}
+
+	// flare connects to various databases with the same password so the entry must match "postgres" (usually "*")
+	pass := passfile.FindPassword(key.Host, key.Port, "postgres", key.User)
+	if pass == "" {
+		return "", fmt.Errorf("flare: no entry for %s@%s:%s/postgres in %s (the database must be * or postgres)", key.User, key.Host, key.Port, fn)
+	}
+
+	return pass, nil
+}
+
+func runSecretCommand(ctx context.Context, command string) (string, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+
+	var out bytes.Buffer
+	var errout bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &errout
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("running the credential helper: %w: %s", err, errout.String())
+	}
+
+	return strings.TrimRight(out.String(), "\r\n"), nil
+}
+
+// ResolveSecrets replaces the references in the password fields with the secrets.
+func (c *ConnConfig) ResolveSecrets(ctx context.Context) error {
+	for _, f := range []struct {
+		name string
+		user string
+		pass *Secret
+	}{
+		{name: "superuser_password", user: c.SuperUser, pass: &c.SuperUserPassword},
+		{name: "db_owner_password", user: c.DBOwner, pass: &c.DBOwnerPassword},
+		{name: "repl_user_password", user: c.ReplicationUser, pass: &c.ReplicationUserPassword},
+	} {
+		if f.pass.From == "" {
+			continue
+		}
+
+		secret, err := f.pass.Resolve(ctx, PGPassKey{Host: c.Host, Port: c.Port, User: f.user})
+		if err != nil {
+			return fmt.Errorf("resolving %s for '%s': %w", f.name, c.Host, err)
+		}
+
+		*f.pass = Secret{Value: secret}
+	}
+
+	return nil
+}
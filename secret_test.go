@@ -0,0 +1,151 @@
+package flare
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecret(t *testing.T) {
+	ctx := context.Background()
+	key := PGPassKey{Host: "db.example.com", Port: "5432", User: "postgres"}
+
+	t.Run("plaintext", func(t *testing.T) {
+		require := require.New(t)
+
+		// the strings that look like references are still the passwords
+		for _, pass := range []string{"pa$$word", "${FLARE_TEST_SECRET}", "exec:rm -rf /", "file:/etc/passwd", "pgpass:"} {
+			secret, err := Secret{Value: pass}.Resolve(ctx, key)
+			require.NoError(err)
+			require.Equal(pass, secret)
+		}
+	})
+
+	t.Run("env", func(t *testing.T) {
+		require := require.New(t)
+
+		t.Setenv("FLARE_TEST_SECRET", "s3cret")
+
+		secret, err := Secret{From: SecretFromEnv, Value: "FLARE_TEST_SECRET"}.Resolve(ctx, key)
+		require.NoError(err)
+		require.Equal("s3cret", secret)
+
+		_, err = Secret{From: SecretFromEnv, Value: "FLARE_TEST_UNSET"}.Resolve(ctx, key)
+		require.EqualError(err, "flare: environment variable FLARE_TEST_UNSET is not set")
+
+		t.Setenv("FLARE_TEST_EMPTY", "")
+
+		_, err = Secret{From: SecretFromEnv, Value: "FLARE_TEST_EMPTY"}.Resolve(ctx, key)
+		require.EqualError(err, "flare: the secret is empty")
+	})
+
+	t.Run("file", func(t *testing.T) {
+		require := require.New(t)
+
+		fn := filepath.Join(t.TempDir(), "password")
+		require.NoError(os.WriteFile(fn, []byte("s3cret\n"), 0o600))
+
+		secret, err := Secret{From: SecretFromFile, Value: fn}.Resolve(ctx, key)
+		require.NoError(err)
+		require.Equal("s3cret", secret)
+	})
+
+	t.Run("pgpass", func(t *testing.T) {
+		require := require.New(t)
+
+		fn := filepath.Join(t.TempDir(), ".pgpass")
+		require.NoError(os.WriteFile(fn, []byte("db.example.com:5432:*:postgres:s3cret\n"), 0o600))
+
+		secret, err := Secret{From: SecretFromPGPass, Value: fn}.Resolve(ctx, key)
+		require.NoError(err)
+		require.Equal("s3cret", secret)
+
+		t.Setenv("PGPASSFILE", fn)
+
+		secret, err = Secret{From: SecretFromPGPass}.Resolve(ctx, key)
+		require.NoError(err)
+		require.Equal("s3cret", secret)
+
+		_, err = Secret{From: SecretFromPGPass}.Resolve(ctx, PGPassKey{Host: "other", Port: "5432", User: "postgres"})
+		require.Error(err)
+	})
+
+	t.Run("exec", func(t *testing.T) {
+		require := require.New(t)
+
+		secret, err := Secret{From: SecretFromExec, Value: "echo s3cret"}.Resolve(ctx, key)
+		require.NoError(err)
+		require.Equal("s3cret", secret)
+
+		_, err = Secret{From: SecretFromExec, Value: "echo s3cret; echo failed >&2; exit 1"}.Resolve(ctx, key)
+		require.Error(err)
+		require.NotContains(err.Error(), "s3cret")
+		require.Contains(err.Error(), "failed")
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		require := require.New(t)
+
+		_, err := Secret{From: "vault", Value: "secret/pg"}.Resolve(ctx, key)
+		require.EqualError(err, "flare: unknown secret source 'vault'")
+	})
+}
+
+func TestSecretYAML(t *testing.T) {
+	require := require.New(t)
+
+	var v struct {
+		Plain Secret `yaml:"plain"`
+		Ref   Secret `yaml:"ref"`
+	}
+
+	require.NoError(yaml.Unmarshal([]byte(`
+plain: 'exec:echo s3cret'
+ref:
+  from: exec
+  value: echo s3cret
+`), &v))
+
+	require.Equal(Secret{Value: "exec:echo s3cret"}, v.Plain)
+	require.Equal(Secret{From: SecretFromExec, Value: "echo s3cret"}, v.Ref)
+
+	b, err := yaml.Marshal(v)
+	require.NoError(err)
+	require.Equal("plain: exec:echo s3cret\nref:\n  from: exec\n  value: echo s3cret\n", string(b))
+
+	require.Error(yaml.Unmarshal([]byte("ref:\n  value: echo s3cret\n"), &v))
+	require.ErrorContains(
+		yaml.Unmarshal([]byte("ref:\n  from: vault\n  value: secret/pg\n"), &v),
+		"flare: unknown secret source 'vault' (env, file, pgpass or exec)",
+	)
+}
+
+func TestConnConfigResolveSecrets(t *testing.T) {
+	require := require.New(t)
+
+	t.Setenv("FLARE_TEST_SUPERUSER_PASSWORD", "s3cret")
+
+	c := ConnConfig{
+		Host:              "db.example.com",
+		Port:              "5432",
+		SuperUser:         "postgres",
+		SuperUserPassword: Secret{From: SecretFromEnv, Value: "FLARE_TEST_SUPERUSER_PASSWORD"},
+		DBOwner:           "app",
+		DBOwnerPassword:   Secret{Value: "${FLARE_TEST_SUPERUSER_PASSWORD}"},
+	}
+
+	require.NoError(c.ResolveSecrets(context.Background()))
+	require.Equal(Secret{Value: "s3cret"}, c.SuperUserPassword)
+	require.Equal(Secret{Value: "${FLARE_TEST_SUPERUSER_PASSWORD}"}, c.DBOwnerPassword)
+	require.True(c.ReplicationUserPassword.IsZero())
+
+	c.ReplicationUser = "repl"
+	c.ReplicationUserPassword = Secret{From: SecretFromEnv, Value: "FLARE_TEST_UNSET"}
+
+	err := c.ResolveSecrets(context.Background())
+	require.EqualError(err, "resolving repl_user_password for 'db.example.com': flare: environment variable FLARE_TEST_UNSET is not set")
+}
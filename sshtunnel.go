@@ -0,0 +1,278 @@
+package flare
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/jackc/pgconn"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHTunnelConfig is the bastion host to reach the database.
+type SSHTunnelConfig struct {
+	Host string `yaml:"host" validate:"required"`
+	Port string `yaml:"port"` // 22 by default
+	User string `yaml:"user" validate:"required"`
+
+	// KeyFile is the private key. ssh-agent (SSH_AUTH_SOCK) is used as well if it's available.
+	KeyFile string `yaml:"key_file"`
+
+	// KnownHostsFile verifies the host key of the bastion (~/.ssh/known_hosts by default).
+	KnownHostsFile string `yaml:"known_hosts_file"`
+
+	// RemoteHost and RemotePort are the database address from the bastion. host and port in the config by default.
+	RemoteHost string `yaml:"remote_host"`
+	RemotePort string `yaml:"remote_port"`
+}
+
+// SSHTunnel forwards the connections to a local port to the database through the bastion.
+type SSHTunnel struct {
+	client   *ssh.Client
+	listener net.Listener
+	remote   string
+
+	wg sync.WaitGroup
+}
+
+// OpenSSHTunnel connects to the bastion and starts forwarding a local port on the loopback interface to remoteAddr.
+func OpenSSHTunnel(ctx context.Context, tc SSHTunnelConfig, remoteAddr string) (*SSHTunnel, error) {
+	scfg, closeAgent, err := tc.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	// ssh-agent is used only for the authentication
+	defer closeAgent()
+
+	port := tc.Port
+	if port == "" {
+		port = "22"
+	}
+
+	addr := net.JoinHostPort(tc.Host, port)
+
+	var d net.Dialer
+	nconn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to the bastion '%s': %w", addr, err)
+	}
+
+	sconn, chans, reqs, err := ssh.NewClientConn(nconn, addr, scfg)
+	if err != nil {
+		nconn.Close()
+		return nil, fmt.Errorf("establishing the SSH connection to '%s': %w", addr, err)
+	}
+
+	client := ssh.NewClient(sconn, chans, reqs)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("listening on a local port: %w", err)
+	}
+
+	t := &SSHTunnel{
+		client:   client,
+		listener: listener,
+		remote:   remoteAddr,
+	}
+
+	t.wg.Add(1)
+	go t.serve()
+
+	return t, nil
+}
+
+// LocalAddr returns the local address to connect to the database.
+func (t *SSHTunnel) LocalAddr() (string, string) {
+	host, port, _ := net.SplitHostPort(t.listener.Addr().String())
+	return host, port
+}
+
+// configure dials the local port of the tunnel in place of the host.
+// The host is kept in the config so that it's still verified as the TLS server name.
+func (t *SSHTunnel) configure(pcfg *pgconn.Config) {
+	addr := t.listener.Addr().String()
+
+	// the host may not be resolvable outside the bastion
+	pcfg.LookupFunc = func(_ context.Context, host string) ([]string, error) {
+		return []string{host}, nil
+	}
+
+	pcfg.DialFunc = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "tcp", addr)
+	}
+}
+
+// Close stops forwarding and closes the SSH connection.
+func (t *SSHTunnel) Close() error {
+	err := t.listener.Close()
+	t.wg.Wait()
+
+	if cerr := t.client.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+func (t *SSHTunnel) serve() {
+	defer t.wg.Done()
+
+	for {
+		lconn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go t.forward(lconn)
+	}
+}
+
+func (t *SSHTunnel) forward(lconn net.Conn) {
+	defer lconn.Close()
+
+	rconn, err := t.client.Dial("tcp", t.remote)
+	if err != nil {
+		log.Printf("WARN: Failed to connect to '%s' through the SSH tunnel: %s", t.remote, err)
+		return
+	}
+	defer rconn.Close()
+
+	done := make(chan struct{}, 2)
+
+	go func() {
+		io.Copy(rconn, lconn)
+		done <- struct{}{}
+	}()
+
+	go func() {
+		io.Copy(lconn, rconn)
+		done <- struct{}{}
+	}()
+
+	<-done
+}
+
+// clientConfig returns the SSH client config and the function to close the connection to ssh-agent.
+func (tc SSHTunnelConfig) clientConfig() (*ssh.ClientConfig, func(), error) {
+	var auths []ssh.AuthMethod
+
+	if tc.KeyFile != "" {
+		b, err := os.ReadFile(expandHome(tc.KeyFile))
+		if err != nil {
+			return nil, nil, fmt.Errorf("reading the SSH key: %w", err)
+		}
+
+		signer, err := ssh.ParsePrivateKey(b)
+		if err != nil {
+			var perr *ssh.PassphraseMissingError
+			if errors.As(err, &perr) {
+				return nil, nil, fmt.Errorf("flare: the SSH key '%s' is encrypted (add it to ssh-agent instead)", tc.KeyFile)
+			}
+
+			return nil, nil, fmt.Errorf("parsing the SSH key: %w", err)
+		}
+
+		auths = append(auths, ssh.PublicKeys(signer))
+	}
+
+	closeAgent := func() {}
+
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		aconn, err := net.Dial("unix", sock)
+		if err != nil {
+			return nil, nil, fmt.Errorf("connecting to ssh-agent: %w", err)
+		}
+
+		closeAgent = func() { aconn.Close() }
+
+		auths = append(auths, ssh.PublicKeysCallback(agent.NewClient(aconn).Signers))
+	}
+
+	if len(auths) == 0 {
+		return nil, nil, errors.New("flare: no SSH key for the tunnel (set key_file or SSH_AUTH_SOCK)")
+	}
+
+	khfn := tc.KnownHostsFile
+	if khfn == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			closeAgent()
+			return nil, nil, fmt.Errorf("looking up the home directory for known_hosts: %w", err)
+		}
+
+		khfn = filepath.Join(home, ".ssh", "known_hosts")
+	}
+
+	hostKeyCallback, err := knownhosts.New(expandHome(khfn))
+	if err != nil {
+		closeAgent()
+		return nil, nil, fmt.Errorf("reading known_hosts: %w", err)
+	}
+
+	return &ssh.ClientConfig{
+		User:            tc.User,
+		Auth:            auths,
+		HostKeyCallback: hostKeyCallback,
+	}, closeAgent, nil
+}
+
+// OpenSSHTunnel opens the SSH tunnel if it's configured and connects flare, psql and pg_dump through the tunnel.
+// The host and the port are kept so that the host is verified in TLS and the subscriber connects to the original address.
+// The tunnel is never used by the subscriber: it is expected to reach the publisher directly
+// (port_via_subscriber can't be set together with ssh_tunnel).
+// It returns nil if the tunnel isn't configured.
+func (c *ConnConfig) OpenSSHTunnel(ctx context.Context) (*SSHTunnel, error) {
+	if c.SSHTunnel == nil {
+		return nil, nil
+	}
+
+	remoteHost := c.SSHTunnel.RemoteHost
+	if remoteHost == "" {
+		remoteHost = c.Host
+	}
+
+	remotePort := c.SSHTunnel.RemotePort
+	if remotePort == "" {
+		remotePort = c.Port
+	}
+
+	if strings.HasPrefix(remoteHost, "/") {
+		return nil, fmt.Errorf("flare: the SSH tunnel for '%s' can't forward to a Unix-domain socket", c.Host)
+	}
+
+	t, err := OpenSSHTunnel(ctx, *c.SSHTunnel, net.JoinHostPort(remoteHost, remotePort))
+	if err != nil {
+		return nil, fmt.Errorf("opening the SSH tunnel for '%s': %w", c.Host, err)
+	}
+
+	c.tunnel = t
+
+	return t, nil
+}
+
+// expandHome expands ~/ at the beginning of the path.
+func expandHome(fn string) string {
+	if !strings.HasPrefix(fn, "~/") {
+		return fn
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fn
+	}
+
+	return filepath.Join(home, fn[2:])
+}
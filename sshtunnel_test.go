@@ -0,0 +1,343 @@
+package flare
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// startSSHServer starts a SSH server that accepts the client key and forwards direct-tcpip channels.
+func startSSHServer(t *testing.T, clientKey ssh.PublicKey) (string, ssh.PublicKey) {
+	_, hostPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	hostSigner, err := ssh.NewSignerFromKey(hostPriv)
+	require.NoError(t, err)
+
+	scfg := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) != string(clientKey.Marshal()) {
+				return nil, fmt.Errorf("unknown key")
+			}
+			return nil, nil
+		},
+	}
+	scfg.AddHostKey(hostSigner)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			nconn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(nconn, scfg)
+				if err != nil {
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+
+				for nch := range chans {
+					var payload struct {
+						Host       string
+						Port       uint32
+						OriginHost string
+						OriginPort uint32
+					}
+					if err := ssh.Unmarshal(nch.ExtraData(), &payload); err != nil {
+						nch.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+
+					rconn, err := net.Dial("tcp", net.JoinHostPort(payload.Host, fmt.Sprint(payload.Port)))
+					if err != nil {
+						nch.Reject(ssh.ConnectionFailed, err.Error())
+						continue
+					}
+
+					ch, chreqs, err := nch.Accept()
+					if err != nil {
+						rconn.Close()
+						continue
+					}
+					go ssh.DiscardRequests(chreqs)
+
+					go func() {
+						defer ch.Close()
+						defer rconn.Close()
+
+						go io.Copy(rconn, ch)
+						io.Copy(ch, rconn)
+					}()
+				}
+			}()
+		}
+	}()
+
+	return l.Addr().String(), hostSigner.PublicKey()
+}
+
+func TestSSHTunnel(t *testing.T) {
+	require := require.New(t)
+
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	dir := t.TempDir()
+
+	_, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(clientPriv)
+	require.NoError(err)
+
+	keyFile := filepath.Join(dir, "id_ed25519")
+	require.NoError(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+
+	clientSigner, err := ssh.NewSignerFromKey(clientPriv)
+	require.NoError(err)
+
+	bastion, hostKey := startSSHServer(t, clientSigner.PublicKey())
+	bastionHost, bastionPort, err := net.SplitHostPort(bastion)
+	require.NoError(err)
+
+	knownHosts := filepath.Join(dir, "known_hosts")
+	require.NoError(os.WriteFile(knownHosts, []byte(knownhosts.Line([]string{bastion}, hostKey)+"\n"), 0o600))
+
+	// the database behind the bastion
+	db, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(err)
+	defer db.Close()
+
+	go func() {
+		for {
+			conn, err := db.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	dbHost, dbPort, err := net.SplitHostPort(db.Addr().String())
+	require.NoError(err)
+
+	c := ConnConfig{
+		Host: "db.internal",
+		Port: "5432",
+		SSHTunnel: &SSHTunnelConfig{
+			Host:           bastionHost,
+			Port:           bastionPort,
+			User:           "flare",
+			KeyFile:        keyFile,
+			KnownHostsFile: knownHosts,
+			RemoteHost:     dbHost,
+			RemotePort:     dbPort,
+		},
+	}
+
+	tunnel, err := c.OpenSSHTunnel(context.Background())
+	require.NoError(err)
+	defer tunnel.Close()
+
+	require.Equal("db.internal", c.Host)
+	require.Equal("5432", c.Port)
+
+	localHost, localPort := tunnel.LocalAddr()
+	require.Equal("127.0.0.1", localHost)
+
+	args := c.SuperUserInfo().PSQLArgs()
+	require.Equal([]string{"-h", "db.internal", "-p", localPort}, args.BuildArgs())
+	require.Contains(args.Env(), "PGHOSTADDR=127.0.0.1")
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(localHost, localPort))
+	require.NoError(err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte("ping"))
+	require.NoError(err)
+
+	buf := make([]byte, 4)
+	_, err = io.ReadFull(conn, buf)
+	require.NoError(err)
+	require.Equal("ping", string(buf))
+
+	t.Run("verify-full", func(t *testing.T) {
+		caFile, serverCert := newTestCertificates(t, dir, "db.internal")
+
+		pg, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(err)
+		defer pg.Close()
+
+		go servePGError(pg, serverCert, "flare tunnel test")
+
+		pgHost, pgPort, err := net.SplitHostPort(pg.Addr().String())
+		require.NoError(err)
+
+		c := ConnConfig{
+			SuperUser: "postgres",
+			Host:      "db.internal",
+			Port:      "5432",
+			TLS:       TLSConfig{SSLMode: "verify-full", SSLRootCert: caFile},
+			SSHTunnel: &SSHTunnelConfig{
+				Host:           bastionHost,
+				Port:           bastionPort,
+				User:           "flare",
+				KeyFile:        keyFile,
+				KnownHostsFile: knownHosts,
+				RemoteHost:     pgHost,
+				RemotePort:     pgPort,
+			},
+		}
+
+		tunnel, err := c.OpenSSHTunnel(context.Background())
+		require.NoError(err)
+		defer tunnel.Close()
+
+		// the server responds after the TLS handshake verified db.internal
+		_, err = ConnectWithoutVerify(context.Background(), c.SuperUserInfo(), "postgres")
+		require.ErrorContains(err, "flare tunnel test")
+
+		c.Host = "other.internal"
+
+		_, err = ConnectWithoutVerify(context.Background(), c.SuperUserInfo(), "postgres")
+		require.ErrorContains(err, "other.internal")
+		require.NotContains(err.Error(), "flare tunnel test")
+	})
+
+	t.Run("Unknown host key", func(t *testing.T) {
+		emptyKnownHosts := filepath.Join(dir, "empty_known_hosts")
+		require.NoError(os.WriteFile(emptyKnownHosts, nil, 0o600))
+
+		c := ConnConfig{
+			Host: "db.internal",
+			Port: "5432",
+			SSHTunnel: &SSHTunnelConfig{
+				Host:           bastionHost,
+				Port:           bastionPort,
+				User:           "flare",
+				KeyFile:        keyFile,
+				KnownHostsFile: emptyKnownHosts,
+			},
+		}
+
+		_, err := c.OpenSSHTunnel(context.Background())
+		require.Error(err)
+		require.Equal("db.internal", c.Host)
+	})
+
+	t.Run("Not configured", func(t *testing.T) {
+		c := ConnConfig{Host: "db.internal", Port: "5432"}
+
+		tunnel, err := c.OpenSSHTunnel(context.Background())
+		require.NoError(err)
+		require.Nil(tunnel)
+	})
+}
+
+// newTestCertificates writes a CA certificate and returns it with a server certificate for the host signed by the CA.
+func newTestCertificates(t *testing.T, dir, host string) (string, tls.Certificate) {
+	caPub, caPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "flare test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, caPub, caPriv)
+	require.NoError(t, err)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o600))
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	der, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}, ca, pub, caPriv)
+	require.NoError(t, err)
+
+	return caFile, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv}
+}
+
+// servePGError accepts SSLRequest, completes the TLS handshake and responds to the startup message with an error.
+func servePGError(l net.Listener, cert tls.Certificate, message string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+
+			// SSLRequest
+			if _, err := io.ReadFull(conn, make([]byte, 8)); err != nil {
+				return
+			}
+
+			if _, err := conn.Write([]byte("S")); err != nil {
+				return
+			}
+
+			tconn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+			if err := tconn.Handshake(); err != nil {
+				return
+			}
+
+			// StartupMessage
+			var size uint32
+			if err := binary.Read(tconn, binary.BigEndian, &size); err != nil {
+				return
+			}
+
+			if _, err := io.ReadFull(tconn, make([]byte, size-4)); err != nil {
+				return
+			}
+
+			fields := "SFATAL\x00C28000\x00M" + message + "\x00\x00"
+
+			msg := make([]byte, 5, 5+len(fields))
+			msg[0] = 'E'
+			binary.BigEndian.PutUint32(msg[1:], uint32(len(fields)+4))
+			tconn.Write(append(msg, fields...))
+		}()
+	}
+}
@@ -0,0 +1,129 @@
+package flare
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+// TablespaceMapping renames a tablespace in the publisher and moves it to a different location in the subscriber.
+type TablespaceMapping struct {
+	// Name is the name in the subscriber. The name in the publisher is used if empty.
+	Name string `yaml:"name"`
+
+	// Location is the directory in the subscriber. The location in the publisher is used if empty.
+	Location string `yaml:"location"`
+}
+
+type TablespaceMap map[string]TablespaceMapping
+
+// Map returns the name in the subscriber.
+func (m TablespaceMap) Map(name string) string {
+	if tm, ok := m[name]; ok && tm.Name != "" {
+		return tm.Name
+	}
+
+	return name
+}
+
+// DumpTablespaces dumps CREATE TABLESPACE and the privileges on the tablespaces.
+func DumpTablespaces(ui UserInfo) (string, error) {
+	args := ui.PSQLArgs()
+	args.Args = []string{"--tablespaces-only"}
+
+	return PGDumpAll(args)
+}
+
+// RemapTablespaces rewrites the tablespace names and the locations in the output of pg_dump and pg_dumpall.
+func RemapTablespaces(sql string, m TablespaceMap) (string, error) {
+	if len(m) == 0 {
+		return sql, nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(sql))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+
+	var b strings.Builder
+
+	for scanner.Scan() {
+		fmt.Fprintf(&b, "%s\n", remapTablespacesInLine(scanner.Text(), m))
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("scanning the SQL: %w", err)
+	}
+
+	return b.String(), nil
+}
+
+func remapTablespacesInLine(line string, m TablespaceMap) string {
+	tokens := tokenizeSQLLine(line)
+
+	isPunct := func(i int, p string) bool {
+		return i < len(tokens) && tokens[i].kind == sqlTokenPunct && tokens[i].text == p
+	}
+
+	replace := map[int]string{}
+
+	// the tablespace that the LOCATION belongs to
+	var current string
+
+	for i, t := range tokens {
+		switch {
+		case t.isKeyword("TABLESPACE") || t.isKeyword("default_tablespace"):
+			j := i + 1
+			if isPunct(j, "=") {
+				j++
+			}
+
+			if j >= len(tokens) || tokens[j].kind == sqlTokenPunct {
+				continue
+			}
+
+			name := tokens[j].name()
+			if _, ok := m[name]; !ok {
+				continue
+			}
+
+			current = name
+
+			mapped := m.Map(name)
+			if mapped == name {
+				continue
+			}
+
+			// pg_dump writes SET default_tablespace = '' to reset it
+			if tokens[j].kind == sqlTokenLiteral {
+				replace[j] = quoteLiteral(mapped)
+			} else {
+				replace[j] = quoteIdentifier(mapped)
+			}
+		case t.isKeyword("LOCATION") && current != "":
+			if i+1 < len(tokens) && tokens[i+1].kind == sqlTokenLiteral && m[current].Location != "" {
+				replace[i+1] = quoteLiteral(m[current].Location)
+			}
+		}
+	}
+
+	if len(replace) == 0 {
+		return line
+	}
+
+	var b strings.Builder
+	last := 0
+
+	for i, t := range tokens {
+		r, ok := replace[i]
+		if !ok {
+			continue
+		}
+
+		b.WriteString(line[last:t.start])
+		b.WriteString(r)
+		last = t.end
+	}
+
+	b.WriteString(line[last:])
+
+	return b.String()
+}
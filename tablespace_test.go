@@ -0,0 +1,41 @@
+package flare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRemapTablespaces(t *testing.T) {
+	input := `CREATE TABLESPACE fast OWNER postgres LOCATION '/mnt/fast';
+GRANT ALL ON TABLESPACE fast TO app;
+COMMENT ON TABLESPACE archive IS 'archive';
+CREATE TABLESPACE archive OWNER postgres LOCATION '/mnt/archive';
+CREATE TABLESPACE other OWNER postgres LOCATION '/mnt/other';
+SET default_tablespace = fast;
+SET default_tablespace = '';
+CREATE TABLE public.items (id integer) TABLESPACE fast;
+CREATE INDEX items_id ON public.items USING btree (id) TABLESPACE "fast";
+CREATE DATABASE bench WITH TEMPLATE = template0 ENCODING = 'UTF8' TABLESPACE = fast;
+`
+	expected := `CREATE TABLESPACE "ssd" OWNER postgres LOCATION '/data/ssd';
+GRANT ALL ON TABLESPACE "ssd" TO app;
+COMMENT ON TABLESPACE archive IS 'archive';
+CREATE TABLESPACE archive OWNER postgres LOCATION '/data/archive';
+CREATE TABLESPACE other OWNER postgres LOCATION '/mnt/other';
+SET default_tablespace = "ssd";
+SET default_tablespace = '';
+CREATE TABLE public.items (id integer) TABLESPACE "ssd";
+CREATE INDEX items_id ON public.items USING btree (id) TABLESPACE "ssd";
+CREATE DATABASE bench WITH TEMPLATE = template0 ENCODING = 'UTF8' TABLESPACE = "ssd";
+`
+
+	require := require.New(t)
+
+	actual, err := RemapTablespaces(input, TablespaceMap{
+		"fast":    {Name: "ssd", Location: "/data/ssd"},
+		"archive": {Location: "/data/archive"},
+	})
+	require.NoError(err)
+	require.Equal(expected, actual)
+}
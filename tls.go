@@ -0,0 +1,60 @@
+package flare
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TLSConfig is the libpq TLS settings for a host.
+type TLSConfig struct {
+	SSLMode     string `yaml:"sslmode" validate:"omitempty,oneof=disable allow prefer require verify-ca verify-full"`
+	SSLRootCert string `yaml:"sslrootcert"`
+	SSLCert     string `yaml:"sslcert"`
+	SSLKey      string `yaml:"sslkey"`
+}
+
+// Merge returns the config overridden by the non-empty fields in o.
+func (c TLSConfig) Merge(o TLSConfig) TLSConfig {
+	if o.SSLMode != "" {
+		c.SSLMode = o.SSLMode
+	}
+	if o.SSLRootCert != "" {
+		c.SSLRootCert = o.SSLRootCert
+	}
+	if o.SSLCert != "" {
+		c.SSLCert = o.SSLCert
+	}
+	if o.SSLKey != "" {
+		c.SSLKey = o.SSLKey
+	}
+
+	return c
+}
+
+func (c TLSConfig) params() [][2]string {
+	var params [][2]string
+
+	for _, p := range [][2]string{
+		{"sslmode", c.SSLMode},
+		{"sslrootcert", c.SSLRootCert},
+		{"sslcert", c.SSLCert},
+		{"sslkey", c.SSLKey},
+	} {
+		if p[1] != "" {
+			params = append(params, p)
+		}
+	}
+
+	return params
+}
+
+// Env returns the settings as PGSSL* environment variables for psql, pg_dump and pg_dumpall.
+func (c TLSConfig) Env() []string {
+	var env []string
+
+	for _, p := range c.params() {
+		env = append(env, fmt.Sprintf("PG%s=%s", strings.ToUpper(p[0]), p[1]))
+	}
+
+	return env
+}
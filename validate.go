@@ -0,0 +1,180 @@
+package flare
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ConfigError is a semantic error in the config. Path is the path to the field in YAML.
+type ConfigError struct {
+	Path    string
+	Message string
+}
+
+func (e ConfigError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+// ConfigErrors is all the semantic errors in the config.
+type ConfigErrors []ConfigError
+
+func (e ConfigErrors) Error() string {
+	var msgs []string
+	for _, ce := range e {
+		msgs = append(msgs, ce.Error())
+	}
+
+	return "flare: invalid config: " + strings.Join(msgs, "; ")
+}
+
+// ValidateOptions enables the checks that depend on how the config is used.
+type ValidateOptions struct {
+	// RequireReplicationUser requires repl_user and repl_user_password in the publisher (e.g. --use-repl-user).
+	RequireReplicationUser bool
+}
+
+// Validate validates the cross references and the values in the config that the struct tags can't express.
+func (c Config) Validate(opts ValidateOptions) error {
+	var errs ConfigErrors
+
+	add := func(path, format string, args ...interface{}) {
+		errs = append(errs, ConfigError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, side := range []struct {
+		name string
+		host Host
+	}{
+		{name: "publisher", host: c.Hosts.Publisher},
+		{name: "subscriber", host: c.Hosts.Subscriber},
+	} {
+		conn := side.host.Conn
+		path := "hosts." + side.name + ".conn"
+
+		for _, p := range []struct {
+			name  string
+			value string
+		}{
+			{name: "port", value: conn.Port},
+			{name: "port_via_subscriber", value: conn.PortViaSubscriber},
+		} {
+			if p.value != "" && !isValidPort(p.value) {
+				add(path+"."+p.name, "must be a port number but got '%s'", p.value)
+			}
+		}
+
+		if conn.SSHTunnel != nil {
+			for _, p := range []struct {
+				name  string
+				value string
+			}{
+				{name: "port", value: conn.SSHTunnel.Port},
+				{name: "remote_port", value: conn.SSHTunnel.RemotePort},
+			} {
+				if p.value != "" && !isValidPort(p.value) {
+					add(path+".ssh_tunnel."+p.name, "must be a port number but got '%s'", p.value)
+				}
+			}
+
+			// the tunnel is only for flare so the subscriber must reach the host without it
+			if conn.PortViaSubscriber != "" {
+				add(path+".port_via_subscriber", "can't be used with ssh_tunnel since the subscriber connects to the host directly")
+			}
+		}
+
+		if _, err := strconv.ParseInt(conn.SystemIdentifier, 10, 64); err != nil {
+			add(path+".system_identifier", "must be a number but got '%s'", conn.SystemIdentifier)
+		}
+
+		if !conn.ReplicationUserPassword.IsZero() && conn.ReplicationUser == "" {
+			add(path+".repl_user", "is required when repl_user_password is set")
+		}
+	}
+
+	pub := c.Hosts.Publisher.Conn
+	sub := c.Hosts.Subscriber.Conn
+
+	if pub.SystemIdentifier == sub.SystemIdentifier && pub.Identity == sub.Identity {
+		add(
+			"hosts.subscriber.conn.system_identifier",
+			"must be different from the publisher (or set identity to tell apart the servers cloned from the same snapshot)",
+		)
+	}
+
+	if opts.RequireReplicationUser {
+		if pub.ReplicationUser == "" {
+			add("hosts.publisher.conn.repl_user", "is required to use the replication user")
+		}
+
+		if pub.ReplicationUserPassword.IsZero() {
+			add("hosts.publisher.conn.repl_user_password", "is required to use the replication user")
+		}
+	}
+
+	for _, dbName := range sortedKeys(c.Publications) {
+		if c.Publications[dbName].PubName == "" {
+			add("publications."+dbName+".pubname", "is required")
+		}
+	}
+
+	for _, subName := range sortedKeys(c.Subscriptions) {
+		s := c.Subscriptions[subName]
+		path := "subscriptions." + subName
+
+		if s.DBName == "" {
+			add(path+".dbname", "is required")
+		}
+
+		if s.PubName == "" {
+			add(path+".pubname", "is required")
+		} else if s.DBName != "" {
+			p, ok := c.Publications[s.DBName]
+			switch {
+			case !ok:
+				add(path+".dbname", "publication for '%s' is not found in publications", s.DBName)
+			case p.PubName != s.PubName:
+				add(path+".pubname", "'%s' doesn't match the publication '%s' in publications.%s", s.PubName, p.PubName, s.DBName)
+			}
+		}
+
+		switch s.PasswordMode {
+		case "", SubscriptionPasswordEmbed, SubscriptionPasswordPassfile, SubscriptionPasswordNone:
+		default:
+			add(path+".password_mode", "must be one of embed, passfile or none but got '%s'", s.PasswordMode)
+		}
+
+		if s.Passfile != "" && s.PasswordMode != SubscriptionPasswordPassfile {
+			add(path+".passfile", "requires password_mode: passfile")
+		}
+	}
+
+	targets := map[string]string{}
+	for _, role := range sortedKeys(c.RoleMap) {
+		target := c.RoleMap[role]
+		if other, ok := targets[target]; ok {
+			add("role_map."+role, "'%s' is mapped from '%s' as well", target, other)
+		}
+		targets[target] = role
+	}
+
+	dbTargets := map[string]string{}
+	for _, dbName := range sortedKeys(c.Databases) {
+		target := c.SubscriberDBName(dbName)
+		if other, ok := dbTargets[target]; ok {
+			add("databases."+dbName+".target_dbname", "'%s' is used for '%s' as well", target, other)
+		}
+		dbTargets[target] = dbName
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+func isValidPort(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0 && n < 65536
+}
@@ -0,0 +1,104 @@
+package flare
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigSemanticValidate(t *testing.T) {
+	require := require.New(t)
+
+	cfg := Config{
+		Hosts: Hosts{
+			Publisher: Host{Conn: ConnConfig{
+				SuperUserPassword:       Secret{Value: "password"},
+				DBOwnerPassword:         Secret{From: SecretFromEnv, Value: "OWNER_PASSWORD"},
+				Port:                    "5432",
+				PortViaSubscriber:       "65536",
+				ReplicationUserPassword: Secret{Value: "repl"},
+				SystemIdentifier:        "12345",
+			}},
+			Subscriber: Host{Conn: ConnConfig{
+				SuperUserPassword: Secret{Value: "password"},
+				Port:              "5432",
+				PortViaSubscriber: "5433",
+				SystemIdentifier:  "12345",
+				SSHTunnel:         &SSHTunnelConfig{Port: "ssh"},
+			}},
+		},
+		Publications: map[string]Publication{
+			"bench": {PubName: "bench"},
+		},
+		Subscriptions: map[string]Subscription{
+			"bench1": {DBName: "bench", PubName: "bench2"},
+			"bench2": {DBName: "other", PubName: "other"},
+			"bench3": {DBName: "bench", PubName: "bench", Passfile: "/var/lib/postgresql/.pgpass"},
+			"bench4": {DBName: "bench", PubName: "bench", PasswordMode: "embedded"},
+		},
+		RoleMap: RoleMap{"app": "app_rw", "app2": "app_rw"},
+		Databases: map[string]DatabaseConfig{
+			"bench": {TargetDBName: "bench_v2"},
+			"other": {TargetDBName: "bench_v2"},
+		},
+	}
+
+	err := cfg.Validate(ValidateOptions{RequireReplicationUser: true})
+	require.Equal(ConfigErrors{
+		{Path: "hosts.publisher.conn.port_via_subscriber", Message: "must be a port number but got '65536'"},
+		{Path: "hosts.publisher.conn.repl_user", Message: "is required when repl_user_password is set"},
+		{Path: "hosts.subscriber.conn.ssh_tunnel.port", Message: "must be a port number but got 'ssh'"},
+		{Path: "hosts.subscriber.conn.port_via_subscriber", Message: "can't be used with ssh_tunnel since the subscriber connects to the host directly"},
+		{Path: "hosts.subscriber.conn.system_identifier", Message: "must be different from the publisher (or set identity to tell apart the servers cloned from the same snapshot)"},
+		{Path: "hosts.publisher.conn.repl_user", Message: "is required to use the replication user"},
+		{Path: "subscriptions.bench1.pubname", Message: "'bench2' doesn't match the publication 'bench' in publications.bench"},
+		{Path: "subscriptions.bench2.dbname", Message: "publication for 'other' is not found in publications"},
+		{Path: "subscriptions.bench3.passfile", Message: "requires password_mode: passfile"},
+		{Path: "subscriptions.bench4.password_mode", Message: "must be one of embed, passfile or none but got 'embedded'"},
+		{Path: "role_map.app2", Message: "'app_rw' is mapped from 'app' as well"},
+		{Path: "databases.other.target_dbname", Message: "'bench_v2' is used for 'bench' as well"},
+	}, err)
+
+	cfg.Hosts.Publisher.Conn.PortViaSubscriber = ""
+	cfg.Hosts.Publisher.Conn.ReplicationUser = "repl"
+	cfg.Hosts.Subscriber.Conn.SSHTunnel = nil
+	cfg.Hosts.Subscriber.Conn.DBOwnerPassword = Secret{From: SecretFromPGPass}
+	cfg.Hosts.Subscriber.Conn.Identity.Marker = "subscriber"
+	cfg.Subscriptions = map[string]Subscription{"bench1": {DBName: "bench", PubName: "bench"}}
+	cfg.RoleMap = nil
+	cfg.Databases = nil
+
+	require.NoError(cfg.Validate(ValidateOptions{RequireReplicationUser: true}))
+}
+
+func TestValidateConfig(t *testing.T) {
+	require := require.New(t)
+
+	b := mustReadTestData("example.yml")
+	require.NoError(ValidateConfig(b, ValidateOptions{}))
+
+	_, err := ParseConfig([]byte(`
+hosts:
+  publisher:
+    conn:
+      superuser: postgres
+      superuser_password:
+        from: env
+        value: FLARE_TEST_UNSET
+      db_owner: owner
+      db_owner_password: owner
+      host: publisher
+      port: '5432'
+      system_identifier: '12345'
+  subscriber:
+    conn:
+      superuser: postgres
+      superuser_password: password
+      db_owner: owner
+      db_owner_password: owner
+      host: subscriber
+      port: '5432'
+      system_identifier: '12345'
+`))
+	require.EqualError(err, "flare: invalid config: hosts.subscriber.conn.system_identifier: must be different from the publisher (or set identity to tell apart the servers cloned from the same snapshot)")
+}